@@ -0,0 +1,48 @@
+package dbx_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/gostratum/dbx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestQueryCaller(t *testing.T) {
+	logger := dbx.NewRecordingLogger()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: dbx.NewGormLogger(logger, "warn", time.Nanosecond),
+	})
+	require.NoError(t, err)
+
+	require.NoError(t, db.Exec("SELECT 1").Error)
+	assert.Contains(t, logger.LastField("Slow SQL query detected", "query_caller"), "caller_test.go:")
+
+	assert.Error(t, db.Exec("SELECT * FROM missing").Error)
+	assert.Contains(t, logger.LastField("SQL execution failed", "query_caller"), "caller_test.go:")
+}
+
+func TestTransactionCaller(t *testing.T) {
+	logger := dbx.NewRecordingLogger()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{})
+	require.NoError(t, err)
+	dbx.RegisterTxState(t, db, "primary", &dbx.DatabaseConfig{TxLeakDetection: true}, logger)
+
+	require.NoError(t, dbx.WithTx(db, func(tx *gorm.DB) error {
+		open := dbx.OpenTransactions(db)
+		require.Len(t, open, 1)
+		assert.Contains(t, open[0].Caller, "caller_test.go:")
+		return nil
+	}))
+
+	tx := dbx.NewTxManager(db).Begin()
+	require.NoError(t, tx.Error)
+	defer tx.Rollback()
+
+	open := dbx.OpenTransactions(db)
+	require.Len(t, open, 1)
+	assert.Contains(t, open[0].Caller, "caller_test.go:")
+}
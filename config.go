@@ -37,6 +37,43 @@ type DatabaseConfig struct {
 	PrepareStmt     bool              `mapstructure:"prepare_stmt" yaml:"prepare_stmt" default:"true"`
 	Params          map[string]string `mapstructure:"params" yaml:"params"`
 
+	// SQL Logging
+	// LogSQLMode controls how statements are logged: "full" (values interpolated),
+	// "placeholders" (no values) or "params" (values logged separately, redacted)
+	LogSQLMode string `mapstructure:"log_sql_mode" yaml:"log_sql_mode" default:"full"`
+	// LogRedactColumns lists columns whose values are redacted in params mode
+	LogRedactColumns []string `mapstructure:"log_redact_columns" yaml:"log_redact_columns"`
+	// LogSampleBurst logs at most this many slow query and error entries per
+	// query shape per LogSampleInterval, then a summary (0 disables sampling)
+	LogSampleBurst    int           `mapstructure:"log_sample_burst" yaml:"log_sample_burst" default:"0"`
+	LogSampleInterval time.Duration `mapstructure:"log_sample_interval" yaml:"log_sample_interval" default:"1m"`
+
+	// ExplainSlowQueries captures EXPLAIN (FORMAT JSON) plans of slow queries
+	// on a separate connection, at most once per query shape per ExplainInterval.
+	// ExplainAnalyze adds ANALYZE for plain SELECTs, which runs them again.
+	ExplainSlowQueries bool          `mapstructure:"explain_slow_queries" yaml:"explain_slow_queries" default:"false"`
+	ExplainAnalyze     bool          `mapstructure:"explain_analyze" yaml:"explain_analyze" default:"false"`
+	ExplainInterval    time.Duration `mapstructure:"explain_interval" yaml:"explain_interval" default:"10m"`
+	ExplainTimeout     time.Duration `mapstructure:"explain_timeout" yaml:"explain_timeout" default:"5s"`
+
+	// Transaction guardrails applied with SET LOCAL to every transaction
+	// started through dbx (0 disables the setting)
+	StatementTimeout       time.Duration `mapstructure:"statement_timeout" yaml:"statement_timeout" default:"0s"`
+	LockTimeout            time.Duration `mapstructure:"lock_timeout" yaml:"lock_timeout" default:"0s"`
+	IdleInTxSessionTimeout time.Duration `mapstructure:"idle_in_transaction_session_timeout" yaml:"idle_in_transaction_session_timeout" default:"0s"`
+
+	// LongTxThreshold logs a warning with the call site when a transaction
+	// started through dbx stays open longer than this (0 disables)
+	LongTxThreshold time.Duration `mapstructure:"long_tx_threshold" yaml:"long_tx_threshold" default:"0s"`
+
+	// TxLeakDetection records the stack of every transaction begun with
+	// TxManager.Begin and reports unfinished ones on module stop
+	TxLeakDetection bool `mapstructure:"tx_leak_detection" yaml:"tx_leak_detection" default:"false"`
+
+	// TxAutoRollback rolls back transactions begun with TxManager.Begin once
+	// their context is done
+	TxAutoRollback bool `mapstructure:"tx_auto_rollback" yaml:"tx_auto_rollback" default:"false"`
+
 	// Migration Settings
 	// MigrationSource defines where migration files are located
 	// Formats:
@@ -59,6 +96,109 @@ type DatabaseConfig struct {
 
 	// MigrationVerbose enables verbose logging for migrations
 	MigrationVerbose bool `mapstructure:"migration_verbose" yaml:"migration_verbose" default:"false"`
+
+	// Server Compatibility (Postgres only), verified when the module starts
+	// MinServerVersion is the oldest accepted server version, e.g. "14" or "13.4"
+	MinServerVersion string `mapstructure:"min_server_version" yaml:"min_server_version"`
+	// RequiredExtensions lists extensions that must be installed, e.g. ["pgcrypto"]
+	RequiredExtensions []string `mapstructure:"required_extensions" yaml:"required_extensions"`
+
+	// Outbox configures the transactional outbox for this database
+	Outbox OutboxConfig `mapstructure:"outbox" yaml:"outbox"`
+
+	// Health configures the readiness and liveness checks for this database
+	Health HealthConfig `mapstructure:"health" yaml:"health"`
+
+	// SQLComment appends a SQLCommenter-style comment to every statement
+	SQLComment SQLCommentConfig `mapstructure:"sql_comment" yaml:"sql_comment"`
+}
+
+// SQLCommentConfig configures the comment appended to statements so they can
+// be correlated in pg_stat_activity and server logs
+type SQLCommentConfig struct {
+	// Enabled appends /*database='name',...*/ to every statement
+	Enabled bool `mapstructure:"enabled" yaml:"enabled" default:"false"`
+
+	// Application is added as the application tag
+	Application string `mapstructure:"application" yaml:"application"`
+
+	// Traceparent adds the W3C traceparent of the statement's span. Every
+	// statement becomes unique, so it requires prepare_stmt to be disabled.
+	Traceparent bool `mapstructure:"traceparent" yaml:"traceparent" default:"false"`
+}
+
+// OutboxConfig configures the transactional outbox table and its relay worker
+type OutboxConfig struct {
+	// Enabled turns on the outbox table and relay for this database
+	Enabled bool `mapstructure:"enabled" yaml:"enabled" default:"false"`
+
+	// Table is the name of the outbox table
+	Table string `mapstructure:"table" yaml:"table" default:"dbx_outbox"`
+
+	// PollInterval is how often the relay polls for pending messages when idle
+	PollInterval time.Duration `mapstructure:"poll_interval" yaml:"poll_interval" default:"1s"`
+
+	// BatchSize is the maximum number of messages handed to the publisher at once
+	BatchSize int `mapstructure:"batch_size" yaml:"batch_size" default:"100"`
+
+	// MaxAttempts is the number of delivery attempts before a message is abandoned
+	MaxAttempts int `mapstructure:"max_attempts" yaml:"max_attempts" default:"10"`
+
+	// BackoffBase is the retry delay after the first failed attempt; it doubles per attempt
+	BackoffBase time.Duration `mapstructure:"backoff_base" yaml:"backoff_base" default:"1s"`
+
+	// BackoffMax caps the retry delay between attempts
+	BackoffMax time.Duration `mapstructure:"backoff_max" yaml:"backoff_max" default:"5m"`
+
+	// Retention is how long delivered messages are kept before the relay
+	// deletes them. Messages that exhausted max_attempts are never deleted.
+	Retention time.Duration `mapstructure:"retention" yaml:"retention" default:"24h"`
+}
+
+// HealthConfig configures the health checks registered for a database
+type HealthConfig struct {
+	// DisableReadiness skips registering the readiness check
+	DisableReadiness bool `mapstructure:"disable_readiness" yaml:"disable_readiness" default:"false"`
+
+	// DisableLiveness skips registering the liveness check
+	DisableLiveness bool `mapstructure:"disable_liveness" yaml:"disable_liveness" default:"false"`
+
+	// ReadinessTimeout bounds the readiness ping
+	ReadinessTimeout time.Duration `mapstructure:"readiness_timeout" yaml:"readiness_timeout" default:"3s"`
+
+	// LivenessTimeout bounds the liveness ping and probe query
+	LivenessTimeout time.Duration `mapstructure:"liveness_timeout" yaml:"liveness_timeout" default:"5s"`
+
+	// Query is the liveness probe query; defaults to SELECT 1
+	Query string `mapstructure:"query" yaml:"query"`
+
+	// ExpectedResult is compared with the first column of the probe result.
+	// Empty accepts any result; defaults to "1" when Query is not set.
+	ExpectedResult string `mapstructure:"expected_result" yaml:"expected_result"`
+
+	// CacheTTL reuses a probe result for this long (0 disables caching).
+	// Concurrent probes always share a single in-flight database round-trip.
+	CacheTTL time.Duration `mapstructure:"cache_ttl" yaml:"cache_ttl" default:"0s"`
+
+	// MigrationCheck registers a readiness check that fails while the schema is
+	// dirty or behind the latest version in migration_source
+	MigrationCheck bool `mapstructure:"migration_check" yaml:"migration_check" default:"false"`
+
+	// DisablePoolCheck skips connection pool saturation detection in liveness.
+	// This is the switch to turn the detection off entirely.
+	DisablePoolCheck bool `mapstructure:"disable_pool_check" yaml:"disable_pool_check" default:"false"`
+
+	// PoolSaturationRatio is the in-use/max-open ratio at which the pool counts as full
+	PoolSaturationRatio float64 `mapstructure:"pool_saturation_ratio" yaml:"pool_saturation_ratio" default:"1"`
+
+	// PoolMaxWaitCount fails liveness when a full pool had at least this many
+	// new waits since the previous probe (0, the default, disables this threshold)
+	PoolMaxWaitCount int64 `mapstructure:"pool_max_wait_count" yaml:"pool_max_wait_count" default:"0"`
+
+	// PoolMaxWaitDuration fails liveness when a full pool accumulated at least
+	// this much wait time since the previous probe. 0 uses the default of 1s;
+	// a negative value disables this threshold.
+	PoolMaxWaitDuration time.Duration `mapstructure:"pool_max_wait_duration" yaml:"pool_max_wait_duration" default:"1s"`
 }
 
 // DefaultConfig returns the default database configuration
@@ -75,18 +215,22 @@ func DefaultConfig() *Config {
 func DefaultDatabaseConfig() *DatabaseConfig {
 	return &DatabaseConfig{
 		// Database Connection Settings
-		Driver:          "postgres",
-		Host:            "localhost",
-		Port:            5432,
-		MaxOpenConns:    25,
-		MaxIdleConns:    5,
-		ConnMaxLifetime: 5 * time.Minute,
-		ConnMaxIdleTime: 5 * time.Minute,
-		LogLevel:        "warn",
-		SlowThreshold:   200 * time.Millisecond,
-		SkipDefaultTx:   false,
-		PrepareStmt:     true,
-		Params:          make(map[string]string),
+		Driver:            "postgres",
+		Host:              "localhost",
+		Port:              5432,
+		MaxOpenConns:      25,
+		MaxIdleConns:      5,
+		ConnMaxLifetime:   5 * time.Minute,
+		ConnMaxIdleTime:   5 * time.Minute,
+		LogLevel:          "warn",
+		SlowThreshold:     200 * time.Millisecond,
+		SkipDefaultTx:     false,
+		PrepareStmt:       true,
+		Params:            make(map[string]string),
+		LogSQLMode:        LogSQLFull,
+		LogSampleInterval: time.Minute,
+		ExplainInterval:   10 * time.Minute,
+		ExplainTimeout:    5 * time.Second,
 
 		// Migration Settings (Safe Defaults)
 		MigrationSource:      "",                  // Disabled by default for safety
@@ -94,6 +238,39 @@ func DefaultDatabaseConfig() *DatabaseConfig {
 		MigrationTable:       "schema_migrations", // Standard table name
 		MigrationLockTimeout: 15 * time.Second,    // Reasonable lock timeout
 		MigrationVerbose:     false,               // Quiet by default
+
+		// Outbox Settings (disabled by default)
+		Outbox: DefaultOutboxConfig(),
+
+		// Health Check Settings
+		Health: DefaultHealthConfig(),
+	}
+}
+
+// DefaultHealthConfig returns the default health check configuration
+func DefaultHealthConfig() HealthConfig {
+	return HealthConfig{
+		ReadinessTimeout: 3 * time.Second,
+		LivenessTimeout:  5 * time.Second,
+		Query:            defaultHealthQuery,
+		ExpectedResult:   defaultHealthResult,
+
+		PoolSaturationRatio: 1,
+		PoolMaxWaitDuration: time.Second,
+	}
+}
+
+// DefaultOutboxConfig returns the default outbox configuration
+func DefaultOutboxConfig() OutboxConfig {
+	return OutboxConfig{
+		Enabled:      false,
+		Table:        defaultOutboxTable,
+		PollInterval: time.Second,
+		BatchSize:    100,
+		MaxAttempts:  10,
+		BackoffBase:  time.Second,
+		BackoffMax:   5 * time.Minute,
+		Retention:    24 * time.Hour,
 	}
 }
 
@@ -155,6 +332,36 @@ func (dc *DatabaseConfig) Validate() error {
 		return fmt.Errorf("conn_max_idle_time must be >= 0")
 	}
 
+	if dc.StatementTimeout < 0 || dc.LockTimeout < 0 || dc.IdleInTxSessionTimeout < 0 {
+		return fmt.Errorf("statement_timeout, lock_timeout and idle_in_transaction_session_timeout must be >= 0")
+	}
+
+	switch dc.LogSQLMode {
+	case "", LogSQLFull, LogSQLPlaceholders, LogSQLParams:
+	default:
+		return fmt.Errorf("log_sql_mode must be one of full, placeholders, params")
+	}
+
+	if dc.LogSampleBurst < 0 || dc.LogSampleInterval < 0 {
+		return fmt.Errorf("log_sample_burst and log_sample_interval must be >= 0")
+	}
+
+	if dc.ExplainInterval < 0 || dc.ExplainTimeout < 0 {
+		return fmt.Errorf("explain_interval and explain_timeout must be >= 0")
+	}
+
+	if dc.ExplainSlowQueries && dc.Driver != "postgres" {
+		return fmt.Errorf("explain_slow_queries is only supported for postgres")
+	}
+
+	if dc.SQLComment.Traceparent && dc.PrepareStmt {
+		return fmt.Errorf("sql_comment.traceparent requires prepare_stmt to be disabled")
+	}
+
+	if dc.LongTxThreshold < 0 {
+		return fmt.Errorf("long_tx_threshold must be >= 0")
+	}
+
 	// Validate migration settings
 	if dc.AutoMigrate && dc.MigrationSource == "" {
 		return fmt.Errorf("auto_migrate is enabled but migration_source is empty - specify 'file://./migrations' or 'embed://'")
@@ -174,14 +381,147 @@ func (dc *DatabaseConfig) Validate() error {
 		return fmt.Errorf("migration_lock_timeout must be >= 0")
 	}
 
+	if err := dc.Outbox.Validate(); err != nil {
+		return fmt.Errorf("outbox: %w", err)
+	}
+
+	if err := dc.Health.Validate(); err != nil {
+		return fmt.Errorf("health: %w", err)
+	}
+
+	if dc.MinServerVersion != "" || len(dc.RequiredExtensions) > 0 {
+		if dc.Driver != "postgres" {
+			return fmt.Errorf("min_server_version and required_extensions are only supported for postgres")
+		}
+		if dc.MinServerVersion != "" {
+			if _, err := parseServerVersion(dc.MinServerVersion); err != nil {
+				return fmt.Errorf("invalid min_server_version: %w", err)
+			}
+		}
+	}
+
+	if dc.Health.MigrationCheck && dc.MigrationSource == "" {
+		return fmt.Errorf("health.migration_check requires migration_source")
+	}
+
+	return nil
+}
+
+// Validate validates the outbox configuration
+func (oc *OutboxConfig) Validate() error {
+	if oc.PollInterval < 0 {
+		return fmt.Errorf("poll_interval must be >= 0")
+	}
+
+	if oc.BatchSize < 0 {
+		return fmt.Errorf("batch_size must be >= 0")
+	}
+
+	if oc.MaxAttempts < 0 {
+		return fmt.Errorf("max_attempts must be >= 0")
+	}
+
+	if oc.BackoffBase < 0 || oc.BackoffMax < 0 {
+		return fmt.Errorf("backoff_base and backoff_max must be >= 0")
+	}
+
+	if oc.Retention < 0 {
+		return fmt.Errorf("retention must be >= 0")
+	}
+
+	return nil
+}
+
+// withDefaults returns a copy of the outbox configuration with zero values
+// replaced by defaults, so partially specified configs behave sensibly
+func (oc OutboxConfig) withDefaults() OutboxConfig {
+	def := DefaultOutboxConfig()
+	if oc.Table == "" {
+		oc.Table = def.Table
+	}
+	if oc.PollInterval == 0 {
+		oc.PollInterval = def.PollInterval
+	}
+	if oc.BatchSize == 0 {
+		oc.BatchSize = def.BatchSize
+	}
+	if oc.MaxAttempts == 0 {
+		oc.MaxAttempts = def.MaxAttempts
+	}
+	if oc.BackoffBase == 0 {
+		oc.BackoffBase = def.BackoffBase
+	}
+	if oc.BackoffMax == 0 {
+		oc.BackoffMax = def.BackoffMax
+	}
+	if oc.Retention == 0 {
+		oc.Retention = def.Retention
+	}
+	return oc
+}
+
+// Validate validates the health check configuration
+func (hc *HealthConfig) Validate() error {
+	if hc.ReadinessTimeout < 0 || hc.LivenessTimeout < 0 {
+		return fmt.Errorf("readiness_timeout and liveness_timeout must be >= 0")
+	}
+
+	if hc.CacheTTL < 0 {
+		return fmt.Errorf("cache_ttl must be >= 0")
+	}
+
+	if hc.Query == "" && hc.ExpectedResult != "" {
+		return fmt.Errorf("expected_result requires query")
+	}
+
+	if hc.PoolSaturationRatio < 0 || hc.PoolSaturationRatio > 1 {
+		return fmt.Errorf("pool_saturation_ratio must be between 0 and 1")
+	}
+
+	if hc.PoolMaxWaitCount < 0 {
+		return fmt.Errorf("pool_max_wait_count must be >= 0")
+	}
+
 	return nil
 }
 
+// withDefaults returns a copy of the health configuration with zero values
+// replaced by defaults
+func (hc HealthConfig) withDefaults() HealthConfig {
+	def := DefaultHealthConfig()
+	if hc.ReadinessTimeout == 0 {
+		hc.ReadinessTimeout = def.ReadinessTimeout
+	}
+	if hc.LivenessTimeout == 0 {
+		hc.LivenessTimeout = def.LivenessTimeout
+	}
+	if hc.Query == "" {
+		hc.Query = def.Query
+		hc.ExpectedResult = def.ExpectedResult
+	}
+	if hc.PoolSaturationRatio == 0 {
+		hc.PoolSaturationRatio = def.PoolSaturationRatio
+	}
+	if hc.PoolMaxWaitDuration == 0 {
+		hc.PoolMaxWaitDuration = def.PoolMaxWaitDuration
+	}
+	return hc
+}
+
 // isValidFileURL checks if a string is a valid file:// URL
 func isValidFileURL(s string) bool {
 	return len(s) > 7 && s[:7] == "file://"
 }
 
+// TxOptions returns the transaction defaults configured for this database
+func (dc *DatabaseConfig) TxOptions() TxOptions {
+	return TxOptions{
+		StatementTimeout:       dc.StatementTimeout,
+		LockTimeout:            dc.LockTimeout,
+		IdleInTxSessionTimeout: dc.IdleInTxSessionTimeout,
+	}
+}
+
 // Migration interface methods for DatabaseConfig
 // These allow the migrate package to use DatabaseConfig without circular imports
 
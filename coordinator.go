@@ -0,0 +1,607 @@
+package dbx
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gostratum/core/logx"
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultCoordinatorLogTable = "dbx_tx_coordinator_log"
+
+	// preparedTxPrefix marks prepared transactions owned by the coordinator
+	preparedTxPrefix = "dbx"
+
+	decisionPending = "pending"
+	decisionCommit  = "commit"
+	decisionAbort   = "abort"
+
+	// completionAttempts bounds the tries of COMMIT/ROLLBACK PREPARED
+	completionAttempts = 3
+	completionBackoff  = 100 * time.Millisecond
+)
+
+var (
+	// ErrTwoPhaseUnsupported is returned when a participant does not support prepared transactions
+	ErrTwoPhaseUnsupported = errors.New("two-phase commit requires postgres participants")
+
+	// ErrNoParticipants is returned when a distributed transaction names no databases
+	ErrNoParticipants = errors.New("two-phase commit requires at least one database")
+
+	// errAlreadyDecided is returned when recording a decision for a transaction
+	// that was decided in the meantime, e.g. aborted by recovery
+	errAlreadyDecided = errors.New("distributed transaction already decided")
+)
+
+// CoordinatorLogEntry records the outcome of a distributed transaction.
+// The commit decision is durable once the entry is marked "commit".
+type CoordinatorLogEntry struct {
+	ID           string     `gorm:"primaryKey;size:64" json:"id"`
+	Participants string     `gorm:"not null" json:"participants"`
+	Decision     string     `gorm:"size:16;not null;index" json:"decision"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DecidedAt    *time.Time `json:"decided_at,omitempty"`
+	CompletedAt  *time.Time `gorm:"index" json:"completed_at,omitempty"`
+}
+
+// TableName returns the default coordinator log table name
+func (CoordinatorLogEntry) TableName() string {
+	return defaultCoordinatorLogTable
+}
+
+// TxCoordinator runs a closure across several named connections using
+// Postgres PREPARE TRANSACTION / COMMIT PREPARED. Participants must run
+// with max_prepared_transactions > 0.
+type TxCoordinator struct {
+	connections       Connections
+	logDatabase       string
+	logTable          string
+	recoveryGrace     time.Duration
+	recoveryInterval  time.Duration
+	completionTimeout time.Duration
+	logger            logx.Logger
+
+	mu   sync.Mutex
+	stop chan struct{}
+}
+
+// CoordinatorOption configures the transaction coordinator
+type CoordinatorOption func(*TxCoordinator)
+
+// WithCoordinatorLogTable sets the table used for the coordinator log
+func WithCoordinatorLogTable(table string) CoordinatorOption {
+	return func(c *TxCoordinator) {
+		c.logTable = table
+	}
+}
+
+// WithRecoveryGrace sets how old an undecided prepared transaction must be
+// before recovery presumes it aborted. This protects transactions that are
+// still in flight in other processes.
+func WithRecoveryGrace(d time.Duration) CoordinatorOption {
+	return func(c *TxCoordinator) {
+		c.recoveryGrace = d
+	}
+}
+
+// WithRecoveryInterval sets how often the module runs Recover in the
+// background (default 1m). Zero disables the loop; recovery still runs at
+// startup and Recover can be called directly.
+func WithRecoveryInterval(d time.Duration) CoordinatorOption {
+	return func(c *TxCoordinator) {
+		c.recoveryInterval = d
+	}
+}
+
+// WithCompletionTimeout bounds recording the decision and finishing the
+// prepared transactions (default 30s). This phase ignores cancellation of
+// the context passed to Run, so the outcome is applied once decided.
+func WithCompletionTimeout(d time.Duration) CoordinatorOption {
+	return func(c *TxCoordinator) {
+		c.completionTimeout = d
+	}
+}
+
+// NewTxCoordinator creates a coordinator that keeps its decision log in the
+// named database
+func NewTxCoordinator(connections Connections, logDatabase string, logger logx.Logger, opts ...CoordinatorOption) (*TxCoordinator, error) {
+	if _, ok := connections[logDatabase]; !ok {
+		return nil, fmt.Errorf("coordinator log database '%s' not found in configured databases", logDatabase)
+	}
+
+	c := &TxCoordinator{
+		connections:       connections,
+		logDatabase:       logDatabase,
+		logTable:          defaultCoordinatorLogTable,
+		recoveryGrace:     time.Minute,
+		recoveryInterval:  time.Minute,
+		completionTimeout: 30 * time.Second,
+		logger:            logger.With(logx.String("component", "tx_coordinator")),
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+// EnsureLogTable creates or updates the coordinator log table
+func (c *TxCoordinator) EnsureLogTable(ctx context.Context) error {
+	if err := c.logDB(ctx).AutoMigrate(&CoordinatorLogEntry{}); err != nil {
+		return fmt.Errorf("failed to migrate coordinator log table %s: %w", c.logTable, err)
+	}
+	return nil
+}
+
+// Run executes fn with one transaction per named database and commits them
+// atomically. If fn or any prepare step fails, every participant is rolled
+// back. Recording the decision and finishing prepared participants ignore
+// the cancellation of ctx, bounded by the completion timeout, and are
+// retried on failure. Once the commit decision is logged the outcome is
+// final; participants that still fail to commit are resolved by Recover.
+func (c *TxCoordinator) Run(ctx context.Context, databases []string, fn func(ctx context.Context, txs map[string]*gorm.DB) error) error {
+	names, err := c.participants(databases)
+	if err != nil {
+		return err
+	}
+
+	id, err := newGlobalTxID()
+	if err != nil {
+		return err
+	}
+
+	entry := CoordinatorLogEntry{
+		ID:           id,
+		Participants: strings.Join(names, ","),
+		Decision:     decisionPending,
+		CreatedAt:    time.Now().UTC(),
+	}
+	if err := c.logDB(ctx).Create(&entry).Error; err != nil {
+		return fmt.Errorf("failed to record distributed transaction %s: %w", id, err)
+	}
+
+	// Phase 0: run the closure against one transaction per participant
+	txs := make(map[string]*gorm.DB, len(names))
+	rollbackOpen := func() {
+		for _, tx := range txs {
+			tx.Rollback()
+		}
+	}
+	abort := func() {
+		cctx, cancel := c.completionContext(ctx)
+		defer cancel()
+		c.decide(cctx, id, decisionAbort, true)
+	}
+
+	for _, name := range names {
+		// Database transaction defaults, metrics and tracing apply to every branch
+		tx := beginTx(c.connections[name].WithContext(ctx))
+		if tx.Error != nil {
+			rollbackOpen()
+			abort()
+			return fmt.Errorf("failed to begin transaction on %s: %w", name, tx.Error)
+		}
+		txs[name] = tx
+	}
+
+	if err := fn(ctx, txs); err != nil {
+		rollbackOpen()
+		abort()
+		return err
+	}
+
+	// Prepared transactions hold their locks until finished, so recording the
+	// decision and finishing them ignore the caller's cancellation
+	cctx, cancel := c.completionContext(ctx)
+	defer cancel()
+
+	// Phase 1: prepare every participant
+	var prepared []preparedBranch
+	for _, name := range names {
+		tx := txs[name]
+		delete(txs, name)
+
+		if err := controlExec(cctx, tx, "PREPARE TRANSACTION "+quoteLiteral(preparedTxGID(id, name))); err != nil {
+			tx.Rollback()
+			rollbackOpen()
+			if c.decide(cctx, id, decisionAbort, false) == nil {
+				c.finish(cctx, id, prepared, "ROLLBACK PREPARED")
+			}
+			return fmt.Errorf("failed to prepare transaction on %s: %w", name, err)
+		}
+
+		// Release the connection; the prepared transaction is no longer bound
+		// to it. Metrics and tracing see the outcome once it is finished.
+		done := detachOutcome(tx)
+		tx.Commit()
+		prepared = append(prepared, preparedBranch{name: name, done: done})
+	}
+
+	// Commit point: the decision is durable once logged
+	if err := c.decide(cctx, id, decisionCommit, false); err != nil {
+		// The write may have failed after the commit was recorded; only roll
+		// back once the abort is on record and leave the rest to Recover
+		if c.decide(cctx, id, decisionAbort, false) == nil {
+			c.finish(cctx, id, prepared, "ROLLBACK PREPARED")
+		}
+		return fmt.Errorf("failed to record commit decision for %s: %w", id, err)
+	}
+
+	// Phase 2: commit every participant
+	c.finish(cctx, id, prepared, "COMMIT PREPARED")
+	return nil
+}
+
+// Recover resolves in-doubt prepared transactions left behind by crashed
+// processes: logged commit decisions are committed, everything else older
+// than the recovery grace period is rolled back. Pending log entries older
+// than the grace period without prepared participants, left by processes
+// that crashed before preparing, are closed as aborted. It returns the
+// number of prepared transactions resolved.
+func (c *TxCoordinator) Recover(ctx context.Context) (int, error) {
+	resolved := 0
+	unresolved := make(map[string]bool)
+	preparedIDs := make(map[string]bool)
+
+	for name, db := range c.connections {
+		if db.Dialector.Name() != "postgres" {
+			continue
+		}
+
+		var rows []struct {
+			GID      string    `gorm:"column:gid"`
+			Prepared time.Time `gorm:"column:prepared"`
+		}
+		if err := db.WithContext(ctx).
+			Raw("SELECT gid, prepared FROM pg_prepared_xacts WHERE database = current_database() AND gid LIKE ?", preparedTxPrefix+":%").
+			Scan(&rows).Error; err != nil {
+			return resolved, fmt.Errorf("failed to list prepared transactions on %s: %w", name, err)
+		}
+
+		for _, row := range rows {
+			id, _, ok := parsePreparedTxGID(row.GID)
+			if !ok {
+				continue
+			}
+			preparedIDs[id] = true
+
+			decision, err := c.resolveDecision(ctx, id, time.Since(row.Prepared))
+			if err != nil {
+				return resolved, err
+			}
+
+			var stmt string
+			switch decision {
+			case decisionCommit:
+				stmt = "COMMIT PREPARED"
+			case decisionAbort:
+				stmt = "ROLLBACK PREPARED"
+			default:
+				unresolved[id] = true
+				continue
+			}
+
+			if err := c.resolvePrepared(ctx, db, stmt, row.GID); err != nil {
+				if isUndefinedObject(err) {
+					// Resolved concurrently, e.g. through another connection to the same database
+					continue
+				}
+				unresolved[id] = true
+				c.logger.Error("Failed to resolve prepared transaction",
+					logx.String("database", name),
+					logx.String("gid", row.GID),
+					logx.Err(err))
+				continue
+			}
+
+			resolved++
+			c.logger.Info("Resolved in-doubt prepared transaction",
+				logx.String("database", name),
+				logx.String("gid", row.GID),
+				logx.String("decision", decision))
+		}
+	}
+
+	// Close out decided entries whose participants no longer hold prepared transactions
+	var open []CoordinatorLogEntry
+	if err := c.logDB(ctx).
+		Where("completed_at IS NULL AND decision <> ? AND created_at < ?", decisionPending, time.Now().UTC().Add(-c.recoveryGrace)).
+		Find(&open).Error; err != nil {
+		return resolved, fmt.Errorf("failed to read coordinator log: %w", err)
+	}
+
+	for _, entry := range open {
+		if !unresolved[entry.ID] {
+			c.complete(ctx, entry.ID)
+		}
+	}
+
+	// Expire entries whose owner never prepared a participant
+	var stale []CoordinatorLogEntry
+	if err := c.logDB(ctx).
+		Where("completed_at IS NULL AND decision = ? AND created_at < ?", decisionPending, time.Now().UTC().Add(-c.recoveryGrace)).
+		Find(&stale).Error; err != nil {
+		return resolved, fmt.Errorf("failed to read coordinator log: %w", err)
+	}
+
+	for _, entry := range stale {
+		if preparedIDs[entry.ID] {
+			continue
+		}
+		// A late owner finds the abort when it records its decision and rolls back
+		if err := c.decide(ctx, entry.ID, decisionAbort, true); err == nil {
+			c.logger.Info("Expired distributed transaction that never prepared",
+				logx.String("id", entry.ID),
+				logx.String("participants", entry.Participants))
+		}
+	}
+
+	return resolved, nil
+}
+
+// resolveDecision returns the decision for an in-doubt transaction, presuming
+// abort for undecided transactions older than the grace period
+func (c *TxCoordinator) resolveDecision(ctx context.Context, id string, age time.Duration) (string, error) {
+	var entries []CoordinatorLogEntry
+	if err := c.logDB(ctx).Where("id = ?", id).Limit(1).Find(&entries).Error; err != nil {
+		return "", fmt.Errorf("failed to read coordinator log entry %s: %w", id, err)
+	}
+
+	if len(entries) > 0 && entries[0].Decision != decisionPending {
+		return entries[0].Decision, nil
+	}
+
+	if age < c.recoveryGrace {
+		return decisionPending, nil
+	}
+
+	if len(entries) == 0 {
+		return decisionAbort, nil
+	}
+
+	// Only abort if the owner has not decided in the meantime
+	res := c.logDB(ctx).Where("id = ? AND decision = ?", id, decisionPending).
+		Updates(map[string]any{"decision": decisionAbort, "decided_at": time.Now().UTC()})
+	if res.Error != nil {
+		return "", fmt.Errorf("failed to record abort decision for %s: %w", id, res.Error)
+	}
+	if res.RowsAffected == 0 {
+		return c.resolveDecision(ctx, id, age)
+	}
+
+	return decisionAbort, nil
+}
+
+// preparedBranch is a participant prepared by Run
+type preparedBranch struct {
+	name string
+	// done finishes the branch's transaction record with its outcome
+	done func(committed bool)
+}
+
+// finish runs the second phase statement on every prepared participant
+func (c *TxCoordinator) finish(ctx context.Context, id string, prepared []preparedBranch, stmt string) {
+	failed := false
+	for _, branch := range prepared {
+		gid := preparedTxGID(id, branch.name)
+		err := c.resolvePrepared(ctx, c.connections[branch.name], stmt, gid)
+		if err != nil && !isUndefinedObject(err) {
+			failed = true
+			branch.done(false)
+			c.logger.Error("Failed to complete prepared transaction, leaving it for recovery",
+				logx.String("database", branch.name),
+				logx.String("gid", gid),
+				logx.String("statement", stmt),
+				logx.Err(err))
+			continue
+		}
+		// Not found means recovery already applied the same decision
+		branch.done(stmt == "COMMIT PREPARED")
+	}
+
+	if !failed {
+		c.complete(ctx, id)
+	}
+}
+
+// completionContext detaches ctx from its cancellation and bounds it by the
+// completion timeout
+func (c *TxCoordinator) completionContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), c.completionTimeout)
+}
+
+// resolvePrepared runs COMMIT PREPARED or ROLLBACK PREPARED for gid,
+// retrying failures with backoff. It stops early when the prepared
+// transaction no longer exists (see isUndefinedObject).
+func (c *TxCoordinator) resolvePrepared(ctx context.Context, db *gorm.DB, stmt, gid string) error {
+	var err error
+	for attempt := 0; attempt < completionAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return err
+			case <-time.After(completionBackoff << (attempt - 1)):
+			}
+		}
+
+		err = controlExec(ctx, db, stmt+" "+quoteLiteral(gid))
+		if err == nil || isUndefinedObject(err) {
+			return err
+		}
+	}
+	return err
+}
+
+// controlExec runs a two-phase commit statement outside GORM's prepared
+// statement cache. Each statement names a unique GID, so caching it would
+// keep a statement per distributed transaction on every participant.
+func controlExec(ctx context.Context, db *gorm.DB, stmt string) error {
+	session := db.Session(&gorm.Session{Context: ctx, NewDB: true})
+	switch pool := session.Statement.ConnPool.(type) {
+	case *gorm.PreparedStmtTX:
+		session.Statement.ConnPool = pool.Tx
+	case *gorm.PreparedStmtDB:
+		session.Statement.ConnPool = pool.ConnPool
+	}
+	return session.Exec(stmt).Error
+}
+
+// isUndefinedObject reports whether err is Postgres' "prepared transaction
+// does not exist" (SQLSTATE 42704)
+func isUndefinedObject(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == "42704"
+}
+
+// decide records the decision for a distributed transaction that is still
+// pending. It returns errAlreadyDecided if recovery decided it first.
+func (c *TxCoordinator) decide(ctx context.Context, id, decision string, complete bool) error {
+	now := time.Now().UTC()
+	updates := map[string]any{"decision": decision, "decided_at": now}
+	if complete {
+		updates["completed_at"] = now
+	}
+
+	res := c.logDB(ctx).Where("id = ? AND decision = ?", id, decisionPending).Updates(updates)
+	err := res.Error
+	if err == nil && res.RowsAffected == 0 {
+		err = errAlreadyDecided
+	}
+	if err != nil {
+		c.logger.Error("Failed to record distributed transaction decision",
+			logx.String("id", id),
+			logx.String("decision", decision),
+			logx.Err(err))
+	}
+	return err
+}
+
+// complete marks a distributed transaction as fully resolved
+func (c *TxCoordinator) complete(ctx context.Context, id string) {
+	if err := c.logDB(ctx).Where("id = ?", id).Update("completed_at", time.Now().UTC()).Error; err != nil {
+		c.logger.Warn("Failed to mark distributed transaction completed",
+			logx.String("id", id),
+			logx.Err(err))
+	}
+}
+
+// startRecovery runs Recover every recovery interval until stopRecovery
+func (c *TxCoordinator) startRecovery() {
+	if c.recoveryInterval <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop != nil {
+		return
+	}
+	c.stop = make(chan struct{})
+	go c.recoverPeriodically(c.stop)
+}
+
+// stopRecovery stops the background recovery loop
+func (c *TxCoordinator) stopRecovery() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop != nil {
+		close(c.stop)
+		c.stop = nil
+	}
+}
+
+// recoverPeriodically resolves in-doubt transactions left by failed commit
+// phases without waiting for a restart
+func (c *TxCoordinator) recoverPeriodically(stop <-chan struct{}) {
+	ticker := time.NewTicker(c.recoveryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			ctx, cancel := c.completionContext(context.Background())
+			resolved, err := c.Recover(ctx)
+			cancel()
+			if err != nil {
+				c.logger.Error("Distributed transaction recovery failed", logx.Err(err))
+			} else if resolved > 0 {
+				c.logger.Info("Resolved in-doubt distributed transactions", logx.Int("resolved", resolved))
+			}
+		case <-stop:
+			return
+		}
+	}
+}
+
+// participants validates and normalizes the participant list
+func (c *TxCoordinator) participants(databases []string) ([]string, error) {
+	seen := make(map[string]bool, len(databases))
+	names := make([]string, 0, len(databases))
+
+	for _, name := range databases {
+		if seen[name] {
+			continue
+		}
+		db, ok := c.connections[name]
+		if !ok {
+			return nil, fmt.Errorf("database '%s' not found in configured databases", name)
+		}
+		if db.Dialector.Name() != "postgres" {
+			return nil, fmt.Errorf("database '%s': %w", name, ErrTwoPhaseUnsupported)
+		}
+		seen[name] = true
+		names = append(names, name)
+	}
+
+	if len(names) == 0 {
+		return nil, ErrNoParticipants
+	}
+
+	// Prepare in a stable order
+	sort.Strings(names)
+	return names, nil
+}
+
+// logDB returns a session on the coordinator log table
+func (c *TxCoordinator) logDB(ctx context.Context) *gorm.DB {
+	return c.connections[c.logDatabase].WithContext(ctx).Table(c.logTable)
+}
+
+// newGlobalTxID generates a random distributed transaction ID
+func newGlobalTxID() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate transaction id: %w", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// preparedTxGID builds the prepared transaction identifier for a participant
+func preparedTxGID(id, database string) string {
+	return preparedTxPrefix + ":" + id + ":" + database
+}
+
+// parsePreparedTxGID splits a prepared transaction identifier built by preparedTxGID
+func parsePreparedTxGID(gid string) (id, database string, ok bool) {
+	parts := strings.SplitN(gid, ":", 3)
+	if len(parts) != 3 || parts[0] != preparedTxPrefix || parts[1] == "" {
+		return "", "", false
+	}
+	return parts[1], parts[2], true
+}
+
+// quoteLiteral quotes a string as a SQL literal
+func quoteLiteral(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", "''") + "'"
+}
@@ -0,0 +1,361 @@
+package dbx
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// postgresTestDSNEnv names the DSN of the Postgres used by integration tests,
+// e.g. the one started by `make db-up`. Tests using it are skipped when unset.
+const postgresTestDSNEnv = "DBX_TEST_POSTGRES_DSN"
+
+// setupPostgresDB opens a connection to the test Postgres or skips the test
+func setupPostgresDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	dsn := os.Getenv(postgresTestDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s not set", postgresTestDSNEnv)
+	}
+
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: gormlogger.Discard})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		if sqlDB, err := db.DB(); err == nil {
+			sqlDB.Close()
+		}
+	})
+	return db
+}
+
+// setupCoordinator returns a coordinator logging to the "log" connection with
+// "orders" and "billing" participants, all on the test Postgres, and a fresh
+// table the participants write to
+func setupCoordinator(t *testing.T, opts ...CoordinatorOption) (*TxCoordinator, Connections, string) {
+	connections := Connections{
+		"log":     setupPostgresDB(t),
+		"orders":  setupPostgresDB(t),
+		"billing": setupPostgresDB(t),
+	}
+	db := connections["log"]
+
+	table := fmt.Sprintf("dbx_coordinator_test_%d", time.Now().UnixNano())
+	opts = append([]CoordinatorOption{WithCoordinatorLogTable(table + "_log")}, opts...)
+	coordinator, err := NewTxCoordinator(connections, "log", &testLogger{}, opts...)
+	require.NoError(t, err)
+
+	require.NoError(t, coordinator.EnsureLogTable(context.Background()))
+	require.NoError(t, db.Exec("CREATE TABLE "+table+" (id serial PRIMARY KEY, db text NOT NULL)").Error)
+	t.Cleanup(func() {
+		// Prepared transactions would keep the tables locked
+		var gids []string
+		db.Raw("SELECT gid FROM pg_prepared_xacts WHERE database = current_database() AND gid LIKE ?", preparedTxPrefix+":%").Scan(&gids)
+		for _, gid := range gids {
+			db.Exec("ROLLBACK PREPARED " + quoteLiteral(gid))
+		}
+		db.Exec("DROP TABLE IF EXISTS " + table)
+		db.Exec("DROP TABLE IF EXISTS " + table + "_log")
+	})
+	return coordinator, connections, table
+}
+
+// insertEach inserts a row per participant
+func insertEach(table string) func(ctx context.Context, txs map[string]*gorm.DB) error {
+	return func(ctx context.Context, txs map[string]*gorm.DB) error {
+		for name, tx := range txs {
+			if err := tx.Exec("INSERT INTO "+table+" (db) VALUES (?)", name).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// countRows counts the committed rows of table
+func countRows(t *testing.T, db *gorm.DB, table string) int64 {
+	var count int64
+	require.NoError(t, db.Table(table).Count(&count).Error)
+	return count
+}
+
+// coordinatorEntry reads the only entry of the coordinator log
+func coordinatorEntry(t *testing.T, c *TxCoordinator) CoordinatorLogEntry {
+	var entries []CoordinatorLogEntry
+	require.NoError(t, c.logDB(context.Background()).Find(&entries).Error)
+	require.Len(t, entries, 1)
+	return entries[0]
+}
+
+// preparedCount counts the coordinator's prepared transactions
+func preparedCount(t *testing.T, db *gorm.DB) int64 {
+	var count int64
+	require.NoError(t, db.Raw("SELECT count(*) FROM pg_prepared_xacts WHERE database = current_database() AND gid LIKE ?", preparedTxPrefix+":%").Scan(&count).Error)
+	return count
+}
+
+func TestPreparedTxGID(t *testing.T) {
+	gid := preparedTxGID("abc123", "analytics")
+	assert.Equal(t, "dbx:abc123:analytics", gid)
+
+	id, database, ok := parsePreparedTxGID(gid)
+	require.True(t, ok)
+	assert.Equal(t, "abc123", id)
+	assert.Equal(t, "analytics", database)
+
+	_, _, ok = parsePreparedTxGID("other:abc:primary")
+	assert.False(t, ok)
+
+	_, _, ok = parsePreparedTxGID("dbx:")
+	assert.False(t, ok)
+}
+
+func TestQuoteLiteral(t *testing.T) {
+	assert.Equal(t, "'dbx:1:primary'", quoteLiteral("dbx:1:primary"))
+	assert.Equal(t, "'it''s'", quoteLiteral("it's"))
+}
+
+func TestTxCoordinatorValidation(t *testing.T) {
+	connections := Connections{"primary": setupTestDB(t)}
+
+	_, err := NewTxCoordinator(connections, "missing", &testLogger{})
+	assert.Error(t, err)
+
+	coordinator, err := NewTxCoordinator(connections, "primary", &testLogger{})
+	require.NoError(t, err)
+
+	noop := func(ctx context.Context, txs map[string]*gorm.DB) error { return nil }
+
+	err = coordinator.Run(context.Background(), nil, noop)
+	assert.ErrorIs(t, err, ErrNoParticipants)
+
+	err = coordinator.Run(context.Background(), []string{"unknown"}, noop)
+	assert.ErrorContains(t, err, "not found")
+
+	// sqlite cannot prepare transactions
+	err = coordinator.Run(context.Background(), []string{"primary"}, noop)
+	assert.ErrorIs(t, err, ErrTwoPhaseUnsupported)
+}
+
+func TestTxCoordinatorCompletionContext(t *testing.T) {
+	coordinator, err := NewTxCoordinator(Connections{"primary": setupTestDB(t)}, "primary", &testLogger{},
+		WithCompletionTimeout(time.Minute))
+	require.NoError(t, err)
+
+	parent, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	ctx, stop := coordinator.completionContext(parent)
+	defer stop()
+	assert.NoError(t, ctx.Err(), "the caller's cancellation does not apply")
+	deadline, ok := ctx.Deadline()
+	require.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), deadline, time.Second)
+}
+
+func TestTxCoordinator_Commit(t *testing.T) {
+	coordinator, connections, table := setupCoordinator(t)
+
+	require.NoError(t, coordinator.Run(context.Background(), []string{"orders", "billing"}, insertEach(table)))
+
+	assert.Equal(t, int64(2), countRows(t, connections["log"], table))
+	entry := coordinatorEntry(t, coordinator)
+	assert.Equal(t, decisionCommit, entry.Decision)
+	assert.NotNil(t, entry.CompletedAt)
+	assert.Zero(t, preparedCount(t, connections["log"]))
+}
+
+func TestControlExec_BypassesStatementCache(t *testing.T) {
+	db := setupTestDB(t).Session(&gorm.Session{PrepareStmt: true})
+	stmts := db.ConnPool.(*gorm.PreparedStmtDB).Stmts
+	ctx := context.Background()
+
+	require.NoError(t, db.Exec("SELECT 1").Error)
+	require.Len(t, stmts.Keys(), 1)
+
+	tx := db.Begin()
+	require.NoError(t, tx.Error)
+	for i := 0; i < 5; i++ {
+		require.NoError(t, controlExec(ctx, db, fmt.Sprintf("SELECT %d", i+2)))
+		require.NoError(t, controlExec(ctx, tx, fmt.Sprintf("SELECT %d", i+10)))
+	}
+	require.NoError(t, tx.Commit().Error)
+
+	assert.Len(t, stmts.Keys(), 1, "control statements are not cached")
+}
+
+func TestTxCoordinator_DoesNotCacheControlStatements(t *testing.T) {
+	coordinator, connections, table := setupCoordinator(t)
+	// PrepareStmt is the module default
+	for _, name := range []string{"orders", "billing"} {
+		connections[name] = connections[name].Session(&gorm.Session{PrepareStmt: true})
+	}
+	stmts := connections["orders"].ConnPool.(*gorm.PreparedStmtDB).Stmts
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, coordinator.Run(context.Background(), []string{"orders", "billing"}, insertEach(table)))
+	}
+
+	for _, key := range stmts.Keys() {
+		assert.NotContains(t, key, "PREPARE", "control statements are not cached")
+	}
+}
+
+func TestTxCoordinator_PrepareFailureRollsBack(t *testing.T) {
+	coordinator, connections, table := setupCoordinator(t)
+
+	// "billing" is prepared first; "orders" cannot be prepared after using a temporary table
+	err := coordinator.Run(context.Background(), []string{"orders", "billing"}, func(ctx context.Context, txs map[string]*gorm.DB) error {
+		if err := insertEach(table)(ctx, txs); err != nil {
+			return err
+		}
+		return txs["orders"].Exec("CREATE TEMP TABLE dbx_coordinator_tmp (id int)").Error
+	})
+	assert.ErrorContains(t, err, "failed to prepare transaction on orders")
+
+	assert.Zero(t, countRows(t, connections["log"], table))
+	entry := coordinatorEntry(t, coordinator)
+	assert.Equal(t, decisionAbort, entry.Decision)
+	assert.NotNil(t, entry.CompletedAt)
+	assert.Zero(t, preparedCount(t, connections["log"]), "the prepared participant is rolled back")
+}
+
+func TestTxCoordinator_CommitsAfterCancellation(t *testing.T) {
+	coordinator, connections, table := setupCoordinator(t)
+
+	// Cancel the caller's context as soon as the commit decision is written
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	require.NoError(t, connections["log"].Callback().Update().After("gorm:update").
+		Register("test:cancel_after_decision", func(*gorm.DB) { cancel() }))
+
+	require.NoError(t, coordinator.Run(ctx, []string{"orders", "billing"}, insertEach(table)))
+	require.Error(t, ctx.Err())
+
+	assert.Equal(t, int64(2), countRows(t, connections["orders"], table))
+	entry := coordinatorEntry(t, coordinator)
+	assert.Equal(t, decisionCommit, entry.Decision)
+	assert.NotNil(t, entry.CompletedAt)
+	assert.Zero(t, preparedCount(t, connections["orders"]))
+}
+
+func TestTxCoordinator_Recover(t *testing.T) {
+	coordinator, connections, table := setupCoordinator(t, WithRecoveryGrace(0))
+	ctx := context.Background()
+
+	// Simulate processes that crashed after the commit decision and before it
+	prepare := func(decision string) string {
+		id, err := newGlobalTxID()
+		require.NoError(t, err)
+
+		created := time.Now().UTC().Add(-time.Minute)
+		entry := CoordinatorLogEntry{ID: id, Participants: "billing,orders", Decision: decision, CreatedAt: created}
+		if decision != decisionPending {
+			entry.DecidedAt = &created
+		}
+		require.NoError(t, coordinator.logDB(ctx).Create(&entry).Error)
+
+		for _, name := range []string{"billing", "orders"} {
+			tx := connections[name].Begin()
+			require.NoError(t, tx.Exec("INSERT INTO "+table+" (db) VALUES (?)", id).Error)
+			require.NoError(t, tx.Exec("PREPARE TRANSACTION "+quoteLiteral(preparedTxGID(id, name))).Error)
+			tx.Commit()
+		}
+		return id
+	}
+	committed := prepare(decisionCommit)
+	aborted := prepare(decisionPending)
+	require.Equal(t, int64(4), preparedCount(t, connections["log"]))
+
+	resolved, err := coordinator.Recover(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 4, resolved)
+	assert.Zero(t, preparedCount(t, connections["log"]))
+
+	var rows []string
+	require.NoError(t, connections["log"].Table(table).Pluck("db", &rows).Error)
+	assert.Equal(t, []string{committed, committed}, rows)
+
+	var entries []CoordinatorLogEntry
+	require.NoError(t, coordinator.logDB(ctx).Order("decision").Find(&entries).Error)
+	require.Len(t, entries, 2)
+	assert.Equal(t, aborted, entries[0].ID)
+	assert.Equal(t, decisionAbort, entries[0].Decision)
+	assert.Equal(t, committed, entries[1].ID)
+	for _, entry := range entries {
+		assert.NotNil(t, entry.CompletedAt, entry.ID)
+	}
+}
+
+func TestTxCoordinator_RecoverExpiresPending(t *testing.T) {
+	coordinator, err := NewTxCoordinator(Connections{"primary": setupTestDB(t)}, "primary", &testLogger{},
+		WithRecoveryGrace(time.Minute))
+	require.NoError(t, err)
+	ctx := context.Background()
+	require.NoError(t, coordinator.EnsureLogTable(ctx))
+
+	// A process that crashed while running fn, and one that is still running it
+	stale := CoordinatorLogEntry{ID: "stale", Participants: "billing,orders", Decision: decisionPending, CreatedAt: time.Now().UTC().Add(-time.Hour)}
+	running := CoordinatorLogEntry{ID: "running", Participants: "billing,orders", Decision: decisionPending, CreatedAt: time.Now().UTC()}
+	require.NoError(t, coordinator.logDB(ctx).Create(&stale).Error)
+	require.NoError(t, coordinator.logDB(ctx).Create(&running).Error)
+
+	resolved, err := coordinator.Recover(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, resolved)
+
+	var entries []CoordinatorLogEntry
+	require.NoError(t, coordinator.logDB(ctx).Order("id").Find(&entries).Error)
+	require.Len(t, entries, 2)
+	assert.Equal(t, "running", entries[0].ID)
+	assert.Equal(t, decisionPending, entries[0].Decision)
+	assert.Nil(t, entries[0].CompletedAt)
+	assert.Equal(t, "stale", entries[1].ID)
+	assert.Equal(t, decisionAbort, entries[1].Decision)
+	assert.NotNil(t, entries[1].CompletedAt)
+}
+
+func TestTxCoordinator_CountsBranchOutcomesAfterSecondPhase(t *testing.T) {
+	coordinator, connections, table := setupCoordinator(t)
+	metrics := newMockMetrics()
+	for _, name := range []string{"orders", "billing"} {
+		state := newTxState(name, &DatabaseConfig{}, &testLogger{})
+		registerState(t, name, connections[name], &connectionState{tx: state})
+		state.setMetrics(metrics)
+	}
+
+	require.NoError(t, coordinator.Run(context.Background(), []string{"orders", "billing"}, insertEach(table)))
+
+	for _, name := range []string{"orders", "billing"} {
+		assert.Equal(t, 1.0, metrics.counter("db_transaction_commits_total", name), name)
+		assert.Zero(t, metrics.counter("db_transaction_rollbacks_total", name), name)
+		assert.Zero(t, metrics.gauge("db_transactions_open", name), name)
+	}
+}
+
+func TestTxCoordinator_AppliesTransactionDefaults(t *testing.T) {
+	coordinator, connections, table := setupCoordinator(t)
+	registerState(t, "orders", connections["orders"], &connectionState{tx: newTxState("orders", &DatabaseConfig{StatementTimeout: 1500 * time.Millisecond}, &testLogger{})})
+
+	timeouts := make(map[string]string)
+	require.NoError(t, coordinator.Run(context.Background(), []string{"orders", "billing"}, func(ctx context.Context, txs map[string]*gorm.DB) error {
+		for name, tx := range txs {
+			var timeout string
+			if err := tx.Raw("SHOW statement_timeout").Scan(&timeout).Error; err != nil {
+				return err
+			}
+			timeouts[name] = timeout
+		}
+		return insertEach(table)(ctx, txs)
+	}))
+
+	assert.Equal(t, "1500ms", timeouts["orders"])
+	assert.Equal(t, "0", timeouts["billing"])
+}
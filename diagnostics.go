@@ -0,0 +1,216 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gostratum/dbx/migrate"
+	"gorm.io/gorm"
+)
+
+// Diagnostics is the JSON document served by DiagnosticsHandler
+type Diagnostics struct {
+	Default   string                         `json:"default"`
+	Databases map[string]DatabaseDiagnostics `json:"databases"`
+	Config    map[string]any                 `json:"config,omitempty"`
+}
+
+// DatabaseDiagnostics describes a single database connection
+type DatabaseDiagnostics struct {
+	Driver        string                `json:"driver"`
+	ServerVersion string                `json:"server_version,omitempty"`
+	Pool          ConnectionStats       `json:"pool"`
+	Replicas      []ReplicaDiagnostics  `json:"replicas,omitempty"`
+	Migration     *MigrationDiagnostics `json:"migration,omitempty"`
+	Errors        []string              `json:"errors,omitempty"`
+}
+
+// ReplicaDiagnostics describes a read replica pool
+type ReplicaDiagnostics struct {
+	Index   int             `json:"index"`
+	Healthy bool            `json:"healthy"`
+	Error   string          `json:"error,omitempty"`
+	Pool    ConnectionStats `json:"pool"`
+}
+
+// MigrationDiagnostics describes the migration state of a database
+type MigrationDiagnostics struct {
+	Version uint `json:"version"`
+	Dirty   bool `json:"dirty"`
+	Latest  uint `json:"latest,omitempty"`
+	Pending int  `json:"pending"`
+}
+
+// DiagnosticsHandler serves database diagnostics as JSON
+type DiagnosticsHandler struct {
+	connections Connections
+	config      *Config
+	authorize   func(r *http.Request) bool
+	timeout     time.Duration
+
+	// migrationStatus is swappable for tests
+	migrationStatus func(ctx context.Context, db *gorm.DB, dbCfg *DatabaseConfig) (migrate.Status, error)
+}
+
+// DiagnosticsOption configures a DiagnosticsHandler
+type DiagnosticsOption func(*DiagnosticsHandler)
+
+// WithDiagnosticsAuth admits only requests for which authorize returns true.
+// Without it the handler rejects every request, since the document exposes
+// pool state, server versions and configuration.
+func WithDiagnosticsAuth(authorize func(r *http.Request) bool) DiagnosticsOption {
+	return func(h *DiagnosticsHandler) {
+		h.authorize = authorize
+	}
+}
+
+// WithDiagnosticsTimeout bounds the database round-trips of a single request
+func WithDiagnosticsTimeout(d time.Duration) DiagnosticsOption {
+	return func(h *DiagnosticsHandler) {
+		h.timeout = d
+	}
+}
+
+// NewDiagnosticsHandler creates a diagnostics handler for the connections
+func NewDiagnosticsHandler(connections Connections, cfg *Config, opts ...DiagnosticsOption) *DiagnosticsHandler {
+	h := &DiagnosticsHandler{
+		connections:     connections,
+		config:          cfg,
+		timeout:         5 * time.Second,
+		migrationStatus: migrationStatusFor,
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// ServeHTTP implements http.Handler
+func (h *DiagnosticsHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+		return
+	}
+
+	if h.authorize == nil || !h.authorize(r) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, h.Collect(r.Context()))
+}
+
+// Collect gathers diagnostics for every database. Failures are reported per
+// database rather than aborting the whole document.
+func (h *DiagnosticsHandler) Collect(ctx context.Context) Diagnostics {
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+
+	out := Diagnostics{Databases: make(map[string]DatabaseDiagnostics, len(h.connections))}
+	if h.config != nil {
+		out.Default = h.config.Default
+		out.Config = h.config.ConfigSummary()
+	}
+
+	for name, db := range h.connections {
+		var dbCfg *DatabaseConfig
+		if h.config != nil {
+			dbCfg = h.config.Databases[name]
+		}
+		out.Databases[name] = h.collectDatabase(ctx, db, dbCfg)
+	}
+
+	return out
+}
+
+// collectDatabase gathers diagnostics for a single database
+func (h *DiagnosticsHandler) collectDatabase(ctx context.Context, db *gorm.DB, dbCfg *DatabaseConfig) DatabaseDiagnostics {
+	diag := DatabaseDiagnostics{Driver: db.Dialector.Name()}
+
+	if sqlDB, err := db.DB(); err != nil {
+		diag.Errors = append(diag.Errors, fmt.Sprintf("pool: %v", err))
+	} else {
+		diag.Pool = newConnectionStats(sqlDB.Stats())
+	}
+
+	// Prefer the version cached at startup; query the server when none was
+	// cached: for non-Postgres drivers and connections created outside the module
+	if diag.ServerVersion = ServerVersion(db); diag.ServerVersion == "" {
+		if version, err := serverVersion(ctx, db); err != nil {
+			diag.Errors = append(diag.Errors, fmt.Sprintf("server version: %v", err))
+		} else {
+			diag.ServerVersion = version
+		}
+	}
+
+	for i, pool := range replicaPools(db) {
+		replica := ReplicaDiagnostics{Index: i, Healthy: true, Pool: newConnectionStats(pool.Stats())}
+		if err := pool.PingContext(ctx); err != nil {
+			replica.Healthy = false
+			replica.Error = err.Error()
+		}
+		diag.Replicas = append(diag.Replicas, replica)
+	}
+
+	if dbCfg != nil && dbCfg.Driver == "postgres" {
+		status, err := h.migrationStatus(ctx, db, dbCfg)
+		if err != nil {
+			diag.Errors = append(diag.Errors, fmt.Sprintf("migration: %v", err))
+		} else {
+			diag.Migration = &MigrationDiagnostics{
+				Version: status.Current,
+				Dirty:   status.Dirty,
+				Latest:  status.Latest,
+				Pending: len(status.Pending),
+			}
+		}
+	}
+
+	return diag
+}
+
+// serverVersion returns the database server version
+func serverVersion(ctx context.Context, db *gorm.DB) (string, error) {
+	var query string
+	switch db.Dialector.Name() {
+	case "postgres":
+		query = "SHOW server_version"
+	case "sqlite":
+		query = "SELECT sqlite_version()"
+	default:
+		return "", nil
+	}
+
+	var version string
+	if err := db.WithContext(ctx).Raw(query).Row().Scan(&version); err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+// newConnectionStats converts database/sql pool statistics
+func newConnectionStats(s sql.DBStats) ConnectionStats {
+	return ConnectionStats{
+		MaxOpenConnections: s.MaxOpenConnections,
+		OpenConnections:    s.OpenConnections,
+		InUse:              s.InUse,
+		Idle:               s.Idle,
+		WaitCount:          s.WaitCount,
+		WaitDuration:       s.WaitDuration,
+		MaxIdleClosed:      s.MaxIdleClosed,
+		MaxLifetimeClosed:  s.MaxLifetimeClosed,
+	}
+}
+
+// writeJSON writes v as a JSON response
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,111 @@
+package dbx
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gostratum/dbx/migrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func newTestDiagnosticsHandler(t *testing.T, opts ...DiagnosticsOption) *DiagnosticsHandler {
+	cfg := &Config{
+		Default: "primary",
+		Databases: map[string]*DatabaseConfig{
+			"primary": {Driver: "postgres", DSN: "postgres://app:secret@db/app"},
+			"cache":   {Driver: "sqlite", DSN: ":memory:"},
+		},
+	}
+	connections := Connections{"primary": setupTestDB(t), "cache": setupTestDB(t)}
+
+	opts = append([]DiagnosticsOption{WithDiagnosticsAuth(func(*http.Request) bool { return true })}, opts...)
+	h := NewDiagnosticsHandler(connections, cfg, opts...)
+	h.migrationStatus = func(ctx context.Context, db *gorm.DB, dbCfg *DatabaseConfig) (migrate.Status, error) {
+		return migrate.Status{Current: 4, Latest: 5, Pending: []uint{5}}, nil
+	}
+	return h
+}
+
+func TestDiagnosticsHandler(t *testing.T) {
+	h := newTestDiagnosticsHandler(t)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/db", nil))
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.NotContains(t, rec.Body.String(), "secret")
+
+	var diag Diagnostics
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &diag))
+	assert.Equal(t, "primary", diag.Default)
+	require.Contains(t, diag.Databases, "primary")
+	require.Contains(t, diag.Databases, "cache")
+
+	primary := diag.Databases["primary"]
+	assert.Equal(t, "sqlite", primary.Driver)
+	assert.NotEmpty(t, primary.ServerVersion)
+	assert.Empty(t, primary.Errors)
+	require.NotNil(t, primary.Migration)
+	assert.Equal(t, MigrationDiagnostics{Version: 4, Latest: 5, Pending: 1}, *primary.Migration)
+
+	assert.Nil(t, diag.Databases["cache"].Migration, "migration status is only read for postgres")
+	assert.Contains(t, diag.Config, "databases")
+}
+
+func TestDiagnosticsHandler_Errors(t *testing.T) {
+	h := newTestDiagnosticsHandler(t)
+	h.migrationStatus = func(ctx context.Context, db *gorm.DB, dbCfg *DatabaseConfig) (migrate.Status, error) {
+		return migrate.Status{}, errors.New("relation does not exist")
+	}
+
+	diag := h.Collect(context.Background())
+	assert.Nil(t, diag.Databases["primary"].Migration)
+	assert.Equal(t, []string{"migration: relation does not exist"}, diag.Databases["primary"].Errors)
+}
+
+func TestDiagnosticsHandler_Auth(t *testing.T) {
+	h := newTestDiagnosticsHandler(t, WithDiagnosticsAuth(func(r *http.Request) bool {
+		return r.Header.Get("X-Debug-Token") == "let-me-in"
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/db", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	req := httptest.NewRequest(http.MethodGet, "/debug/db", nil)
+	req.Header.Set("X-Debug-Token", "let-me-in")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
+
+func TestDiagnosticsHandler_MethodNotAllowed(t *testing.T) {
+	h := newTestDiagnosticsHandler(t)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/debug/db", nil))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "GET, HEAD", rec.Header().Get("Allow"))
+}
+
+func TestDiagnosticsHandler_DeniesWithoutAuthorizer(t *testing.T) {
+	h := NewDiagnosticsHandler(Connections{"primary": setupTestDB(t)}, nil)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/debug/db", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestDiagnosticsHandler_CachedServerVersion(t *testing.T) {
+	db := setupTestDB(t)
+	registerState(t, "primary", db, &connectionState{server: &serverInfo{version: "16.4"}})
+
+	h := NewDiagnosticsHandler(Connections{"primary": db}, nil)
+	assert.Equal(t, "16.4", h.Collect(context.Background()).Databases["primary"].ServerVersion)
+}
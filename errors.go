@@ -0,0 +1,109 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"gorm.io/gorm"
+)
+
+// Error classes reported by ClassifyError and the error_type metric label
+const (
+	ErrorClassUniqueViolation      = "unique_violation"
+	ErrorClassForeignKeyViolation  = "foreign_key_violation"
+	ErrorClassConstraintViolation  = "constraint_violation"
+	ErrorClassSerializationFailure = "serialization_failure"
+	ErrorClassDeadlock             = "deadlock"
+	ErrorClassConnection           = "connection"
+	ErrorClassTimeout              = "timeout"
+	ErrorClassCanceled             = "canceled"
+	ErrorClassSyntax               = "syntax"
+	ErrorClassPermission           = "permission"
+	ErrorClassUndefinedObject      = "undefined_object"
+	ErrorClassQuery                = "query_error"
+)
+
+// ClassifyError returns the class of a query error: the SQLSTATE of
+// Postgres errors, context cancellation and deadlines (wrapped or not) and
+// connection failures are told apart. It returns "" for a nil error.
+func ClassifyError(err error) string {
+	if err == nil {
+		return ""
+	}
+
+	switch {
+	case errors.Is(err, context.Canceled):
+		return ErrorClassCanceled
+	case errors.Is(err, context.DeadlineExceeded):
+		return ErrorClassTimeout
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return classifySQLState(pgErr.Code)
+	}
+
+	switch {
+	case errors.Is(err, gorm.ErrDuplicatedKey):
+		return ErrorClassUniqueViolation
+	case errors.Is(err, gorm.ErrForeignKeyViolated):
+		return ErrorClassForeignKeyViolation
+	case errors.Is(err, gorm.ErrCheckConstraintViolated):
+		return ErrorClassConstraintViolation
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ErrorClassTimeout
+	}
+	var connectErr *pgconn.ConnectError
+	if errors.As(err, &connectErr) || errors.As(err, &netErr) ||
+		errors.Is(err, driver.ErrBadConn) || errors.Is(err, sql.ErrConnDone) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ErrorClassConnection
+	}
+	return ErrorClassQuery
+}
+
+// classifySQLState maps a Postgres SQLSTATE code to an error class
+func classifySQLState(code string) string {
+	switch code {
+	case "23505":
+		return ErrorClassUniqueViolation
+	case "23503":
+		return ErrorClassForeignKeyViolation
+	case "40001":
+		return ErrorClassSerializationFailure
+	case "40P01":
+		return ErrorClassDeadlock
+	case "57014", "55P03", "25P03":
+		// statement_timeout, lock_timeout, idle_in_transaction_session_timeout
+		return ErrorClassTimeout
+	case "57P01", "57P02", "57P03", "53300":
+		// server shutting down or not accepting connections
+		return ErrorClassConnection
+	case "42000", "42601", "42602", "42622", "42939", "42P02":
+		// syntax error, invalid or too long name, reserved name, undefined parameter
+		return ErrorClassSyntax
+	case "42501":
+		// insufficient_privilege
+		return ErrorClassPermission
+	}
+
+	switch {
+	case strings.HasPrefix(code, "08"):
+		return ErrorClassConnection
+	case strings.HasPrefix(code, "23"):
+		return ErrorClassConstraintViolation
+	case strings.HasPrefix(code, "42"):
+		// undefined or duplicate tables, columns, functions and other objects
+		return ErrorClassUndefinedObject
+	}
+	return ErrorClassQuery
+}
@@ -0,0 +1,73 @@
+package dbx
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestClassifyError(t *testing.T) {
+	pgErr := func(code string) error {
+		return fmt.Errorf("query failed: %w", &pgconn.PgError{Code: code})
+	}
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"nil", nil, ""},
+		{"unique", pgErr("23505"), ErrorClassUniqueViolation},
+		{"foreign key", pgErr("23503"), ErrorClassForeignKeyViolation},
+		{"not null", pgErr("23502"), ErrorClassConstraintViolation},
+		{"serialization", pgErr("40001"), ErrorClassSerializationFailure},
+		{"deadlock", pgErr("40P01"), ErrorClassDeadlock},
+		{"statement timeout", pgErr("57014"), ErrorClassTimeout},
+		{"lock timeout", pgErr("55P03"), ErrorClassTimeout},
+		{"connection failure", pgErr("08006"), ErrorClassConnection},
+		{"admin shutdown", pgErr("57P01"), ErrorClassConnection},
+		{"syntax", pgErr("42601"), ErrorClassSyntax},
+		{"syntax or access rule", pgErr("42000"), ErrorClassSyntax},
+		{"name too long", pgErr("42622"), ErrorClassSyntax},
+		{"undefined parameter", pgErr("42P02"), ErrorClassSyntax},
+		{"insufficient privilege", pgErr("42501"), ErrorClassPermission},
+		{"undefined table", pgErr("42P01"), ErrorClassUndefinedObject},
+		{"undefined column", pgErr("42703"), ErrorClassUndefinedObject},
+		{"undefined function", pgErr("42883"), ErrorClassUndefinedObject},
+		{"duplicate table", pgErr("42P07"), ErrorClassUndefinedObject},
+		{"other sqlstate", pgErr("22012"), ErrorClassQuery},
+		{"wrapped canceled", fmt.Errorf("exec: %w", context.Canceled), ErrorClassCanceled},
+		{"wrapped deadline", fmt.Errorf("exec: %w", context.DeadlineExceeded), ErrorClassTimeout},
+		{"gorm duplicated key", gorm.ErrDuplicatedKey, ErrorClassUniqueViolation},
+		{"bad conn", driver.ErrBadConn, ErrorClassConnection},
+		{"net", &net.OpError{Op: "dial", Err: errors.New("connection refused")}, ErrorClassConnection},
+		{"other", errors.New("boom"), ErrorClassQuery},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, ClassifyError(tt.err))
+		})
+	}
+}
+
+func TestMetricsErrorType(t *testing.T) {
+	db := setupTestDB(t)
+	metrics := newMockMetrics()
+	require.NoError(t, db.Use(NewMetricsPlugin(metrics)))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Error(t, db.WithContext(ctx).Exec("SELECT 1").Error)
+	assert.Error(t, db.Exec("SELECT * FROM missing").Error)
+
+	assert.Equal(t, float64(1), metrics.counter("db_query_errors_total", "default", "primary", "unknown", "raw", ErrorClassCanceled))
+	assert.Equal(t, float64(1), metrics.counter("db_query_errors_total", "default", "primary", "unknown", "raw", ErrorClassQuery))
+}
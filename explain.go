@@ -0,0 +1,254 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gostratum/core/logx"
+	"gorm.io/gorm"
+)
+
+const explainPluginName = "dbx:explain"
+
+// QueryPlan is the execution plan captured for a slow query
+type QueryPlan struct {
+	Fingerprint string          `json:"fingerprint"`
+	SQL         string          `json:"sql"`
+	Plan        json.RawMessage `json:"plan"`
+	Analyzed    bool            `json:"analyzed"`
+	Elapsed     time.Duration   `json:"elapsed"`
+	CapturedAt  time.Time       `json:"captured_at"`
+}
+
+// queryExplainer captures EXPLAIN (FORMAT JSON) plans of slow queries on a
+// separate connection, at most once per fingerprint per interval
+type queryExplainer struct {
+	analyze  bool
+	interval time.Duration
+	timeout  time.Duration
+	logger   logx.Logger
+	now      func() time.Time
+
+	// explain runs the EXPLAIN statement; swappable for tests
+	explain func(ctx context.Context, query string, vars []any) (string, error)
+
+	pool *sql.DB
+	busy chan struct{}
+
+	mu    sync.Mutex
+	last  map[string]time.Time
+	plans map[string]QueryPlan
+}
+
+// withExplainer captures plans of slow queries with e
+func withExplainer(e *queryExplainer) GormLoggerOption {
+	return func(l *gormLoggerAdapter) {
+		l.explainer = e
+	}
+}
+
+func newQueryExplainer(dbCfg *DatabaseConfig, logger logx.Logger) *queryExplainer {
+	e := &queryExplainer{
+		analyze:  dbCfg.ExplainAnalyze,
+		interval: dbCfg.ExplainInterval,
+		timeout:  dbCfg.ExplainTimeout,
+		logger:   logger,
+		now:      time.Now,
+		busy:     make(chan struct{}, 1),
+		last:     make(map[string]time.Time),
+		plans:    make(map[string]QueryPlan),
+	}
+	if e.interval <= 0 {
+		e.interval = 10 * time.Minute
+	}
+	if e.timeout <= 0 {
+		e.timeout = 5 * time.Second
+	}
+	e.explain = e.explainPostgres
+	return e
+}
+
+// Name returns the plugin name
+func (e *queryExplainer) Name() string {
+	return explainPluginName
+}
+
+// Initialize keeps the raw pool so plans are captured outside the caller's
+// connection and transaction
+func (e *queryExplainer) Initialize(db *gorm.DB) error {
+	pool, err := db.DB()
+	if err != nil {
+		return err
+	}
+	e.pool = pool
+	return nil
+}
+
+// QueryPlans returns the latest plan captured per fingerprint, newest first
+func QueryPlans(db *gorm.DB) []QueryPlan {
+	if db == nil || db.Config == nil {
+		return nil
+	}
+	e, ok := db.Config.Plugins[explainPluginName].(*queryExplainer)
+	if !ok {
+		return nil
+	}
+	return e.queryPlans()
+}
+
+func (e *queryExplainer) queryPlans() []QueryPlan {
+	e.mu.Lock()
+	out := make([]QueryPlan, 0, len(e.plans))
+	for _, p := range e.plans {
+		out = append(out, p)
+	}
+	e.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].CapturedAt.After(out[j].CapturedAt) })
+	return out
+}
+
+// capture explains the query in the background unless its fingerprint was
+// explained within the interval or another capture is running. query and
+// vars are the SQL and parameters the statement ran with.
+func (e *queryExplainer) capture(query string, vars []any, fingerprint string, elapsed time.Duration) {
+	if !explainable(query) {
+		return
+	}
+
+	select {
+	case e.busy <- struct{}{}:
+	default:
+		return
+	}
+	if !e.reserve(fingerprint) {
+		<-e.busy
+		return
+	}
+
+	vars = append([]any(nil), vars...)
+	analyze := e.analyze && readOnlyQuery(query)
+
+	go func() {
+		defer func() { <-e.busy }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), e.timeout)
+		defer cancel()
+
+		explain := "EXPLAIN (FORMAT JSON) "
+		if analyze {
+			explain = "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) "
+		}
+		plan, err := e.explain(ctx, explain+query, vars)
+		if err != nil {
+			e.logger.Warn("Failed to capture plan for slow SQL query",
+				logx.String("fingerprint", fingerprint),
+				logx.Err(err),
+			)
+			return
+		}
+
+		captured := QueryPlan{
+			Fingerprint: fingerprint,
+			SQL:         query,
+			Plan:        json.RawMessage(plan),
+			Analyzed:    analyze,
+			Elapsed:     elapsed,
+			CapturedAt:  e.now(),
+		}
+		e.mu.Lock()
+		e.plans[fingerprint] = captured
+		e.mu.Unlock()
+
+		e.logger.Warn("Slow SQL query plan",
+			logx.String("fingerprint", fingerprint),
+			logx.String("sql", query),
+			logx.Duration("elapsed", elapsed),
+			logx.Bool("analyzed", analyze),
+			logx.String("plan", plan),
+		)
+	}()
+}
+
+// reserve records an explain for fingerprint if none happened within the interval
+func (e *queryExplainer) reserve(fingerprint string) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	now := e.now()
+	if last, ok := e.last[fingerprint]; ok && now.Sub(last) < e.interval {
+		return false
+	}
+	if len(e.last) >= maxSampledFingerprints {
+		for fp, last := range e.last {
+			if now.Sub(last) >= e.interval {
+				delete(e.last, fp)
+				delete(e.plans, fp)
+			}
+		}
+		if len(e.last) >= maxSampledFingerprints {
+			return false
+		}
+	}
+	e.last[fingerprint] = now
+	return true
+}
+
+// explainPostgres runs the EXPLAIN statement on the raw pool inside a
+// read-only transaction that is always rolled back
+func (e *queryExplainer) explainPostgres(ctx context.Context, query string, vars []any) (string, error) {
+	if e.pool == nil {
+		return "", fmt.Errorf("explain plugin is not initialized")
+	}
+
+	tx, err := e.pool.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var plan string
+	if err := tx.QueryRowContext(ctx, query, vars...).Scan(&plan); err != nil {
+		return "", err
+	}
+	return plan, nil
+}
+
+// explainable reports whether the statement can be explained
+func explainable(query string) bool {
+	switch firstKeyword(query) {
+	case "SELECT", "INSERT", "UPDATE", "DELETE", "WITH":
+		return true
+	}
+	return false
+}
+
+// readOnlyQuery reports whether it is safe to EXPLAIN ANALYZE the statement,
+// which executes it: plain SELECTs without locking clauses or SELECT INTO
+func readOnlyQuery(query string) bool {
+	if firstKeyword(query) != "SELECT" {
+		return false
+	}
+	upper := " " + strings.ToUpper(normalizeSQL(query)) + " "
+	for _, clause := range []string{" INTO ", " FOR UPDATE", " FOR SHARE", " FOR NO KEY UPDATE", " FOR KEY SHARE"} {
+		if strings.Contains(upper, clause) {
+			return false
+		}
+	}
+	return true
+}
+
+// firstKeyword returns the first word of the statement in upper case
+func firstKeyword(query string) string {
+	fields := strings.Fields(normalizeSQL(query))
+	if len(fields) == 0 {
+		return ""
+	}
+	return strings.ToUpper(strings.TrimLeft(fields[0], "("))
+}
@@ -0,0 +1,94 @@
+package dbx
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestReadOnlyQuery(t *testing.T) {
+	assert.True(t, readOnlyQuery(`SELECT * FROM "users" WHERE id = $1`))
+	assert.False(t, readOnlyQuery(`SELECT * FROM "users" WHERE id = $1 FOR UPDATE`))
+	assert.False(t, readOnlyQuery(`SELECT * INTO backup FROM users`))
+	assert.False(t, readOnlyQuery(`UPDATE "users" SET name = $1`))
+	assert.False(t, readOnlyQuery(`WITH d AS (DELETE FROM users RETURNING *) SELECT * FROM d`))
+
+	assert.True(t, explainable(`  /* tag */ SELECT 1`))
+	assert.False(t, explainable(`CREATE TABLE t (id int)`))
+}
+
+func setupExplainedDB(t *testing.T, analyze bool) (*gorm.DB, *queryExplainer, func() []string) {
+	var (
+		mu      sync.Mutex
+		queries []string
+	)
+	explainer := newQueryExplainer(&DatabaseConfig{ExplainAnalyze: analyze, ExplainInterval: time.Hour}, newRecordingLogger())
+	explainer.explain = func(ctx context.Context, query string, vars []any) (string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		queries = append(queries, query)
+		return `[{"Plan": {"Node Type": "Seq Scan"}}]`, nil
+	}
+
+	gormLogger := NewGormLogger(newRecordingLogger(), "warn", time.Nanosecond, withExplainer(explainer))
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormLogger})
+	require.NoError(t, err)
+	require.NoError(t, db.Exec("CREATE TABLE test_users (id INTEGER PRIMARY KEY, name TEXT)").Error)
+	require.NoError(t, db.Use(&statementPlugin{}))
+	require.NoError(t, db.Use(explainer))
+
+	return db, explainer, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), queries...)
+	}
+}
+
+func TestExplainSlowQueries(t *testing.T) {
+	db, explainer, queries := setupExplainedDB(t, true)
+
+	var count int64
+	require.NoError(t, db.Table("test_users").Where("id = ?", 1).Count(&count).Error)
+	waitForPlans(t, db, explainer, 1)
+
+	// Same shape within the interval is not explained again
+	require.NoError(t, db.Table("test_users").Where("id = ?", 2).Count(&count).Error)
+
+	// Writes are never analyzed
+	require.NoError(t, db.Exec("UPDATE test_users SET name = ? WHERE id = ?", "x", 1).Error)
+	waitForPlans(t, db, explainer, 2)
+
+	got := queries()
+	require.Len(t, got, 2)
+	assert.Equal(t, "EXPLAIN (ANALYZE, BUFFERS, FORMAT JSON) SELECT count(*) FROM `test_users` WHERE id = ?", got[0])
+	assert.Equal(t, "EXPLAIN (FORMAT JSON) UPDATE test_users SET name = ? WHERE id = ?", got[1])
+
+	for _, plan := range QueryPlans(db) {
+		assert.Equal(t, strings.HasPrefix(plan.SQL, "SELECT"), plan.Analyzed)
+		assert.JSONEq(t, `[{"Plan": {"Node Type": "Seq Scan"}}]`, string(plan.Plan))
+	}
+}
+
+func TestExplainSlowQueries_RawScan(t *testing.T) {
+	db, explainer, queries := setupExplainedDB(t, false)
+
+	var names []string
+	require.NoError(t, db.Raw("SELECT name FROM test_users WHERE id = ?", 1).Scan(&names).Error)
+	waitForPlans(t, db, explainer, 1)
+
+	assert.Equal(t, []string{"EXPLAIN (FORMAT JSON) SELECT name FROM test_users WHERE id = ?"}, queries())
+}
+
+// waitForPlans waits until n plans are stored and no capture is running
+func waitForPlans(t *testing.T, db *gorm.DB, explainer *queryExplainer, n int) {
+	require.Eventually(t, func() bool {
+		return len(QueryPlans(db)) == n && len(explainer.busy) == 0
+	}, time.Second, 5*time.Millisecond)
+}
@@ -0,0 +1,31 @@
+package dbx
+
+import (
+	"testing"
+
+	"github.com/gostratum/core/logx"
+	"gorm.io/gorm"
+)
+
+// Exports for the tests in package dbx_test, whose frames are outside dbx
+// like an application's
+
+// NewRecordingLogger returns a logger that captures log lines
+func NewRecordingLogger() *recordingLogger {
+	return newRecordingLogger()
+}
+
+// LastField returns a field of the last line logged with msg
+func (l *recordingLogger) LastField(msg, key string) any {
+	entries := l.find(msg)
+	if len(entries) == 0 {
+		return nil
+	}
+	return entries[len(entries)-1].fields[key]
+}
+
+// RegisterTxState registers the transaction state the module keeps for each
+// connection, for the duration of the test
+func RegisterTxState(t *testing.T, db *gorm.DB, name string, dbCfg *DatabaseConfig, logger logx.Logger) {
+	registerState(t, name, db, &connectionState{tx: newTxState(name, dbCfg, logger)})
+}
@@ -0,0 +1,126 @@
+package dbx
+
+import (
+	"fmt"
+	"hash/fnv"
+	"regexp"
+	"strings"
+)
+
+var (
+	// placeholderList matches a parenthesized list of placeholders, e.g. (?, ?, ?)
+	placeholderList = regexp.MustCompile(`\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	// repeatedLists matches consecutive collapsed lists, e.g. VALUES (...),(...)
+	repeatedLists = regexp.MustCompile(`\(\.\.\.\)(?:\s*,\s*\(\.\.\.\))+`)
+)
+
+// Fingerprint returns the normalized shape of a statement and a short, stable
+// hash of it. Statements that differ only in literal values, placeholder style
+// or IN-list length share a fingerprint.
+func Fingerprint(sql string) (normalized, hash string) {
+	normalized = normalizeSQL(sql)
+	return normalized, fingerprintHash(normalized)
+}
+
+// fingerprintHash hashes a normalized statement
+func fingerprintHash(normalized string) string {
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(normalized))
+	return fmt.Sprintf("%016x", h.Sum64())
+}
+
+// normalizeSQL reduces a statement to its shape: literals and placeholders
+// become ?, lists of them collapse to (...), comments are dropped and
+// whitespace is normalized. Statements that differ only in their values
+// normalize to the same string.
+func normalizeSQL(sql string) string {
+	var b strings.Builder
+	b.Grow(len(sql))
+
+	var prev string
+	emit := func(tok string) {
+		if b.Len() > 0 && prev != "(" && prev != "." && tok != ")" && tok != "," && tok != "." && tok != ";" {
+			b.WriteByte(' ')
+		}
+		b.WriteString(tok)
+		prev = tok
+	}
+
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+		case c == '-' && i+1 < len(sql) && sql[i+1] == '-':
+			for i < len(sql) && sql[i] != '\n' {
+				i++
+			}
+		case c == '/' && i+1 < len(sql) && sql[i+1] == '*':
+			end := strings.Index(sql[i+2:], "*/")
+			if end < 0 {
+				i = len(sql)
+			} else {
+				i += end + 3
+			}
+		case c == '\'':
+			for i++; i < len(sql); i++ {
+				if sql[i] == '\'' {
+					if i+1 < len(sql) && sql[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			emit("?")
+		case c == '"' || c == '`':
+			end := strings.IndexByte(sql[i+1:], c)
+			if end < 0 {
+				emit(sql[i:])
+				i = len(sql)
+				continue
+			}
+			emit(sql[i : i+end+2])
+			i += end + 1
+		case c == '$' && i+1 < len(sql) && isDigit(sql[i+1]):
+			for i+1 < len(sql) && isDigit(sql[i+1]) {
+				i++
+			}
+			emit("?")
+		case isDigit(c):
+			for i+1 < len(sql) && (isDigit(sql[i+1]) || sql[i+1] == '.') {
+				i++
+			}
+			emit("?")
+		case isIdentByte(c):
+			j := i + 1
+			for j < len(sql) && (isIdentByte(sql[j]) || isDigit(sql[j]) || sql[j] == '$') {
+				j++
+			}
+			emit(sql[i:j])
+			i = j - 1
+		case strings.IndexByte(operatorBytes, c) >= 0:
+			j := i + 1
+			for j < len(sql) && strings.IndexByte(operatorBytes, sql[j]) >= 0 {
+				j++
+			}
+			emit(sql[i:j])
+			i = j - 1
+		default:
+			emit(string(c))
+		}
+	}
+
+	normalized := placeholderList.ReplaceAllString(b.String(), "(...)")
+	return repeatedLists.ReplaceAllString(normalized, "(...)")
+}
+
+// operatorBytes are grouped into a single token, so <= and :: stay intact
+const operatorBytes = "<>=!:|&+-*/%^~@#"
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func isIdentByte(c byte) bool {
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c >= 0x80
+}
@@ -0,0 +1,88 @@
+package dbx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeSQL(t *testing.T) {
+	tests := []struct {
+		name string
+		a, b string
+	}{
+		{"literals", "SELECT * FROM users WHERE id = 1 AND name = 'bob'", "SELECT * FROM users WHERE id=42 AND name = 'o''neil'"},
+		{"in lists", "SELECT * FROM users WHERE id IN (1,2,3)", "SELECT * FROM users WHERE id IN ($1)"},
+		{"values tuples", `INSERT INTO "users" ("name") VALUES ('a'),('b')`, `INSERT INTO "users" ("name") VALUES ($1)`},
+		{"comments", "SELECT 1 /* app=api */", "-- leading\nSELECT 2"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, normalizeSQL(tt.a), normalizeSQL(tt.b))
+		})
+	}
+
+	assert.Equal(t, `SELECT * FROM users WHERE id IN (...) AND age >= ?`,
+		normalizeSQL("SELECT *\n  FROM users WHERE id IN (1, 2) AND age>=18"))
+	assert.NotEqual(t, normalizeSQL("SELECT * FROM users"), normalizeSQL("SELECT * FROM orders"))
+}
+
+func TestFingerprint(t *testing.T) {
+	shape, hash := Fingerprint(`SELECT * FROM "users" WHERE "id" = $1`)
+	assert.Equal(t, `SELECT * FROM "users" WHERE "id" = ?`, shape)
+	assert.Len(t, hash, 16)
+
+	_, same := Fingerprint(`SELECT *  FROM "users" WHERE "id" = 42`)
+	assert.Equal(t, hash, same)
+
+	_, other := Fingerprint(`SELECT * FROM "orders" WHERE "id" = 42`)
+	assert.NotEqual(t, hash, other)
+}
+
+func TestGormLoggerFingerprint_RawScan(t *testing.T) {
+	db, logger := setupLoggedDB(t, LogSQLPlaceholders)
+
+	var users []redactedUser
+	require.NoError(t, db.Raw("SELECT * FROM redacted_users WHERE email = ?", "a@example.com").Scan(&users).Error)
+	require.NoError(t, db.Raw("SELECT * FROM redacted_users WHERE token = ?", "t0k").Scan(&users).Error)
+
+	entries := logger.find("SQL query executed")
+	require.GreaterOrEqual(t, len(entries), 2)
+	byEmail := entries[len(entries)-2].fields["fingerprint"]
+	byToken := entries[len(entries)-1].fields["fingerprint"]
+
+	_, want := Fingerprint("SELECT * FROM redacted_users WHERE email = ?")
+	assert.Equal(t, want, byEmail)
+	assert.NotEqual(t, byEmail, byToken)
+}
+
+func TestStatementSQL_FallsBackToTraceSQL(t *testing.T) {
+	l := &gormLoggerAdapter{}
+	ctx := context.WithValue(context.Background(), statementKey{}, &loggedStatement{})
+	assert.Equal(t, "SELECT 1", l.statementSQL(ctx, "SELECT 1"))
+
+	ctx = context.WithValue(context.Background(), statementKey{}, &loggedStatement{sql: "SELECT ?"})
+	assert.Equal(t, "SELECT ?", l.statementSQL(ctx, "SELECT 1"))
+}
+
+func TestMetricsFingerprintLabel(t *testing.T) {
+	metrics := newMockMetrics()
+	db := setupTestDB(t)
+	require.NoError(t, db.Exec("CREATE TABLE test_users (id INTEGER PRIMARY KEY, name TEXT)").Error)
+	require.NoError(t, db.Use(NewMetricsPlugin(metrics, WithFingerprintLabel(1))))
+
+	assert.Contains(t, metrics.options["db_queries_total"].Labels, "fingerprint")
+
+	var count int64
+	for i := 0; i < 3; i++ {
+		require.NoError(t, db.Table("test_users").Where("id = ?", i).Count(&count).Error)
+	}
+	require.NoError(t, db.Table("test_users").Where("name = ?", "x").Count(&count).Error)
+
+	_, hash := Fingerprint("SELECT count(*) FROM `test_users` WHERE id = ?")
+	assert.Equal(t, float64(3), metrics.counter("db_queries_total", "default", "primary", "test_users", "select", hash))
+	assert.Equal(t, float64(1), metrics.counter("db_queries_total", "default", "primary", "test_users", "select", "other"))
+}
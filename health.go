@@ -2,10 +2,14 @@ package dbx
 
 import (
 	"context"
+	"database/sql"
+	"errors"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/gostratum/core"
+	"github.com/gostratum/dbx/migrate"
 	"gorm.io/gorm"
 )
 
@@ -28,51 +32,244 @@ func (c *dbCheck) Check(ctx context.Context) error {
 	return c.checkFunc(ctx)
 }
 
+const (
+	defaultHealthQuery  = "SELECT 1"
+	defaultHealthResult = "1"
+)
+
+// HealthCheckGroup is the fx value group collecting CustomHealthCheck values
+const HealthCheckGroup = "dbx_health_checks"
+
+// CustomHealthCheck is a user-defined check run against a named connection.
+// It is registered as "db-<database>-<name>" next to the built-in checks.
+type CustomHealthCheck struct {
+	Name     string
+	Database string
+	Kind     core.Kind
+	Check    func(ctx context.Context, db *gorm.DB) error
+}
+
+// HealthCheckFunc creates a custom health check for the named database
+func HealthCheckFunc(name, database string, kind core.Kind, fn func(ctx context.Context, db *gorm.DB) error) CustomHealthCheck {
+	return CustomHealthCheck{
+		Name:     name,
+		Database: database,
+		Kind:     kind,
+		Check:    fn,
+	}
+}
+
+// cachedProbe deduplicates concurrent runs of a check and caches its result.
+// The shared run is detached from callers' contexts and bounded only by the
+// check's own timeout, so one cancelled caller cannot fail the others and a
+// slow database never has more than one probe in flight.
+type cachedProbe struct {
+	fn  func(ctx context.Context) error
+	ttl time.Duration
+	now func() time.Time
+
+	mu        sync.Mutex
+	inflight  *probeCall
+	hasResult bool
+	err       error
+	checkedAt time.Time
+}
+
+// probeCall is a single in-flight probe shared by concurrent callers
+type probeCall struct {
+	done chan struct{}
+	err  error
+}
+
+// newCachedProbe wraps fn with single-flight deduplication and a result TTL
+func newCachedProbe(fn func(ctx context.Context) error, ttl time.Duration) *cachedProbe {
+	return &cachedProbe{fn: fn, ttl: ttl, now: time.Now}
+}
+
+// check returns the cached result or waits for the shared probe
+func (p *cachedProbe) check(ctx context.Context) error {
+	p.mu.Lock()
+	if p.hasResult && p.ttl > 0 && p.now().Sub(p.checkedAt) < p.ttl {
+		err := p.err
+		p.mu.Unlock()
+		return err
+	}
+
+	call := p.inflight
+	if call == nil {
+		call = &probeCall{done: make(chan struct{})}
+		p.inflight = call
+		go p.run(call)
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.err
+	case <-ctx.Done():
+		return fmt.Errorf("health check abandoned: %w", ctx.Err())
+	}
+}
+
+// run executes the probe and publishes its result
+func (p *cachedProbe) run(call *probeCall) {
+	call.err = p.fn(context.Background())
+
+	p.mu.Lock()
+	p.inflight = nil
+	p.hasResult = true
+	p.err = call.err
+	p.checkedAt = p.now()
+	p.mu.Unlock()
+
+	close(call.done)
+}
+
 // HealthChecker provides health check functionality for database connections
 type HealthChecker struct {
 	connections Connections
 	registry    core.Registry
+	config      *Config
+	custom      []CustomHealthCheck
+
+	// migrationStatus is swappable for tests
+	migrationStatus func(ctx context.Context, db *gorm.DB, dbCfg *DatabaseConfig) (migrate.Status, error)
+}
+
+// HealthCheckerOption configures a HealthChecker
+type HealthCheckerOption func(*HealthChecker)
+
+// WithHealthConfig makes the checker use the per-database health settings
+func WithHealthConfig(cfg *Config) HealthCheckerOption {
+	return func(hc *HealthChecker) {
+		hc.config = cfg
+	}
+}
+
+// WithCustomHealthChecks adds user-defined checks to register
+func WithCustomHealthChecks(checks ...CustomHealthCheck) HealthCheckerOption {
+	return func(hc *HealthChecker) {
+		hc.custom = append(hc.custom, checks...)
+	}
 }
 
 // NewHealthChecker creates a new health checker for database connections
-func NewHealthChecker(connections Connections, registry core.Registry) *HealthChecker {
-	return &HealthChecker{
-		connections: connections,
-		registry:    registry,
+func NewHealthChecker(connections Connections, registry core.Registry, opts ...HealthCheckerOption) *HealthChecker {
+	hc := &HealthChecker{
+		connections:     connections,
+		registry:        registry,
+		migrationStatus: migrationStatusFor,
+	}
+	for _, opt := range opts {
+		opt(hc)
 	}
+	return hc
 }
 
-// RegisterHealthChecks registers health checks for all database connections
+// healthConfig returns the health settings for a database
+func (hc *HealthChecker) healthConfig(name string) HealthConfig {
+	var cfg HealthConfig
+	if hc.config != nil {
+		if dbCfg, ok := hc.config.Databases[name]; ok && dbCfg != nil {
+			cfg = dbCfg.Health
+		}
+	}
+	return cfg.withDefaults()
+}
+
+// RegisterHealthChecks registers health checks for all database connections.
+// The built-in checks are always registered; invalid custom checks are
+// skipped and reported together in the returned error.
 func (hc *HealthChecker) RegisterHealthChecks() error {
 	if hc.registry == nil {
 		return nil // Skip if no registry provided
 	}
 
+	registered := make(map[string]bool)
+	register := func(check *dbCheck) {
+		registered[check.name] = true
+		hc.registry.Register(check)
+	}
+
 	for name, db := range hc.connections {
-		// Create readiness check
-		readinessCheck := &dbCheck{
-			name:      fmt.Sprintf("db-%s-readiness", name),
-			kind:      core.Readiness,
-			checkFunc: hc.createReadinessCheck(db),
+		cfg := hc.healthConfig(name)
+
+		if !cfg.DisableReadiness {
+			register(&dbCheck{
+				name:      fmt.Sprintf("db-%s-readiness", name),
+				kind:      core.Readiness,
+				checkFunc: newCachedProbe(hc.createReadinessCheck(db, cfg), cfg.CacheTTL).check,
+			})
 		}
 
-		// Create liveness check
-		livenessCheck := &dbCheck{
-			name:      fmt.Sprintf("db-%s-liveness", name),
-			kind:      core.Liveness,
-			checkFunc: hc.createLivenessCheck(db),
+		if !cfg.DisableLiveness {
+			register(&dbCheck{
+				name:      fmt.Sprintf("db-%s-liveness", name),
+				kind:      core.Liveness,
+				checkFunc: newCachedProbe(hc.createLivenessCheck(db, cfg), cfg.CacheTTL).check,
+			})
 		}
 
-		// Register checks
-		hc.registry.Register(readinessCheck)
-		hc.registry.Register(livenessCheck)
+		if cfg.MigrationCheck {
+			register(&dbCheck{
+				name:      fmt.Sprintf("db-%s-migrations", name),
+				kind:      core.Readiness,
+				checkFunc: newCachedProbe(hc.createMigrationCheck(db, hc.config.Databases[name], cfg), cfg.CacheTTL).check,
+			})
+		}
 	}
 
-	return nil
+	var errs []error
+	for _, c := range hc.custom {
+		check, err := hc.createCustomCheck(c)
+		if err == nil && registered[check.name] {
+			err = fmt.Errorf("custom health check '%s': a check named '%s' is already registered", c.Name, check.name)
+		}
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		register(check)
+	}
+
+	return errors.Join(errs...)
+}
+
+// createCustomCheck wraps a user-defined check with the database's timeout and caching
+func (hc *HealthChecker) createCustomCheck(custom CustomHealthCheck) (*dbCheck, error) {
+	if custom.Name == "" || custom.Check == nil {
+		return nil, fmt.Errorf("custom health check for database '%s' needs a name and a check function", custom.Database)
+	}
+	if custom.Kind != core.Readiness && custom.Kind != core.Liveness {
+		return nil, fmt.Errorf("custom health check '%s' has unknown kind %q", custom.Name, custom.Kind)
+	}
+
+	db, ok := hc.connections[custom.Database]
+	if !ok {
+		return nil, fmt.Errorf("custom health check '%s': database '%s' not found", custom.Name, custom.Database)
+	}
+
+	cfg := hc.healthConfig(custom.Database)
+	timeout := cfg.ReadinessTimeout
+	if custom.Kind == core.Liveness {
+		timeout = cfg.LivenessTimeout
+	}
+
+	fn := func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+		return custom.Check(ctx, db.WithContext(ctx))
+	}
+
+	return &dbCheck{
+		name:      fmt.Sprintf("db-%s-%s", custom.Database, custom.Name),
+		kind:      custom.Kind,
+		checkFunc: newCachedProbe(fn, cfg.CacheTTL).check,
+	}, nil
 }
 
 // createReadinessCheck creates a readiness check function for a database
-func (hc *HealthChecker) createReadinessCheck(db *gorm.DB) func(ctx context.Context) error {
+func (hc *HealthChecker) createReadinessCheck(db *gorm.DB, cfg HealthConfig) func(ctx context.Context) error {
 	return func(ctx context.Context) error {
 		// Get the underlying sql.DB
 		sqlDB, err := db.DB()
@@ -81,7 +278,7 @@ func (hc *HealthChecker) createReadinessCheck(db *gorm.DB) func(ctx context.Cont
 		}
 
 		// Create context with timeout
-		ctx, cancel := context.WithTimeout(ctx, 3*time.Second)
+		ctx, cancel := context.WithTimeout(ctx, cfg.ReadinessTimeout)
 		defer cancel()
 
 		// Ping the database
@@ -93,8 +290,41 @@ func (hc *HealthChecker) createReadinessCheck(db *gorm.DB) func(ctx context.Cont
 	}
 }
 
+// createMigrationCheck creates a readiness check that fails while the schema
+// is dirty or behind the configured migration source
+func (hc *HealthChecker) createMigrationCheck(db *gorm.DB, dbCfg *DatabaseConfig, cfg HealthConfig) func(ctx context.Context) error {
+	return func(ctx context.Context) error {
+		ctx, cancel := context.WithTimeout(ctx, cfg.ReadinessTimeout)
+		defer cancel()
+
+		status, err := hc.migrationStatus(ctx, db, dbCfg)
+		if err != nil {
+			return fmt.Errorf("failed to get migration status: %w", err)
+		}
+
+		if status.Dirty {
+			return fmt.Errorf("schema is dirty at migration version %d", status.Current)
+		}
+
+		if status.Behind() {
+			return fmt.Errorf("schema at migration version %d is behind latest version %d (%d pending)",
+				status.Current, status.Latest, len(status.Pending))
+		}
+
+		return nil
+	}
+}
+
 // createLivenessCheck creates a liveness check function for a database
-func (hc *HealthChecker) createLivenessCheck(db *gorm.DB) func(ctx context.Context) error {
+func (hc *HealthChecker) createLivenessCheck(db *gorm.DB, cfg HealthConfig) func(ctx context.Context) error {
+	var (
+		mu   sync.Mutex
+		prev sql.DBStats
+	)
+	if sqlDB, err := db.DB(); err == nil {
+		prev = sqlDB.Stats()
+	}
+
 	return func(ctx context.Context) error {
 		// Get the underlying sql.DB
 		sqlDB, err := db.DB()
@@ -102,8 +332,20 @@ func (hc *HealthChecker) createLivenessCheck(db *gorm.DB) func(ctx context.Conte
 			return fmt.Errorf("failed to get underlying DB: %w", err)
 		}
 
+		// Check for pool saturation before the ping, which needs a connection itself
+		if !cfg.DisablePoolCheck {
+			mu.Lock()
+			cur := sqlDB.Stats()
+			err := detectPoolSaturation(prev, cur, cfg)
+			prev = cur
+			mu.Unlock()
+			if err != nil {
+				return err
+			}
+		}
+
 		// Create context with timeout
-		ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		ctx, cancel := context.WithTimeout(ctx, cfg.LivenessTimeout)
 		defer cancel()
 
 		// Ping the database
@@ -111,25 +353,54 @@ func (hc *HealthChecker) createLivenessCheck(db *gorm.DB) func(ctx context.Conte
 			return fmt.Errorf("database ping failed: %w", err)
 		}
 
-		// Check connection pool stats
-		stats := sqlDB.Stats()
-		if stats.OpenConnections > stats.MaxOpenConnections && stats.MaxOpenConnections > 0 {
-			return fmt.Errorf("connection pool exhausted: %d/%d connections in use",
-				stats.OpenConnections, stats.MaxOpenConnections)
-		}
+		// Execute the probe query to ensure the database is responsive
+		return probeQuery(ctx, db, cfg.Query, cfg.ExpectedResult)
+	}
+}
 
-		// Execute a simple query to ensure the database is responsive
-		var result int
-		if err := db.WithContext(ctx).Raw("SELECT 1").Scan(&result).Error; err != nil {
-			return fmt.Errorf("database query failed: %w", err)
-		}
+// detectPoolSaturation reports an error when the pool is at or above the
+// saturation ratio and callers waited for connections since the previous probe
+// beyond the configured thresholds
+func detectPoolSaturation(prev, cur sql.DBStats, cfg HealthConfig) error {
+	if cur.MaxOpenConnections <= 0 {
+		// Unlimited pools never make callers wait
+		return nil
+	}
 
-		if result != 1 {
-			return fmt.Errorf("database query returned unexpected result: %d", result)
-		}
+	waits := cur.WaitCount - prev.WaitCount
+	waited := cur.WaitDuration - prev.WaitDuration
+	if waits <= 0 {
+		return nil
+	}
 
+	ratio := float64(cur.InUse) / float64(cur.MaxOpenConnections)
+	if ratio < cfg.PoolSaturationRatio {
 		return nil
 	}
+
+	countExceeded := cfg.PoolMaxWaitCount > 0 && waits >= cfg.PoolMaxWaitCount
+	durationExceeded := cfg.PoolMaxWaitDuration > 0 && waited >= cfg.PoolMaxWaitDuration
+	if !countExceeded && !durationExceeded {
+		return nil
+	}
+
+	return fmt.Errorf("connection pool saturated: %d/%d connections in use (%.0f%%), %d waits totalling %s since last check (open=%d idle=%d total_waits=%d total_wait=%s)",
+		cur.InUse, cur.MaxOpenConnections, ratio*100, waits, waited,
+		cur.OpenConnections, cur.Idle, cur.WaitCount, cur.WaitDuration)
+}
+
+// probeQuery runs query and compares the first column with expected, if set
+func probeQuery(ctx context.Context, db *gorm.DB, query, expected string) error {
+	var result sql.NullString
+	if err := db.WithContext(ctx).Raw(query).Row().Scan(&result); err != nil {
+		return fmt.Errorf("database query failed: %w", err)
+	}
+
+	if expected != "" && result.String != expected {
+		return fmt.Errorf("database query returned unexpected result: %q (expected %q)", result.String, expected)
+	}
+
+	return nil
 }
 
 // GetConnectionStats returns connection statistics for all databases
@@ -142,17 +413,9 @@ func (hc *HealthChecker) GetConnectionStats() (map[string]ConnectionStats, error
 			return nil, fmt.Errorf("failed to get underlying DB for %s: %w", name, err)
 		}
 
-		dbStats := sqlDB.Stats()
-		stats[name] = ConnectionStats{
-			MaxOpenConnections: dbStats.MaxOpenConnections,
-			OpenConnections:    dbStats.OpenConnections,
-			InUse:              dbStats.InUse,
-			Idle:               dbStats.Idle,
-			WaitCount:          dbStats.WaitCount,
-			WaitDuration:       dbStats.WaitDuration,
-			MaxIdleClosed:      dbStats.MaxIdleClosed,
-			MaxLifetimeClosed:  dbStats.MaxLifetimeClosed,
-		}
+		dbStats := newConnectionStats(sqlDB.Stats())
+		dbStats.ServerVersion = ServerVersion(db)
+		stats[name] = dbStats
 	}
 
 	return stats, nil
@@ -168,4 +431,6 @@ type ConnectionStats struct {
 	WaitDuration       time.Duration `json:"wait_duration"`
 	MaxIdleClosed      int64         `json:"max_idle_closed"`
 	MaxLifetimeClosed  int64         `json:"max_lifetime_closed"`
+	// ServerVersion is the server version detected at startup, if known
+	ServerVersion string `json:"server_version,omitempty"`
 }
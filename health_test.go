@@ -0,0 +1,422 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gostratum/core"
+	"github.com/gostratum/dbx/migrate"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+func TestHealthChecker_Defaults(t *testing.T) {
+	registry := core.NewHealthRegistry()
+	hc := NewHealthChecker(Connections{"primary": setupTestDB(t)}, registry)
+	require.NoError(t, hc.RegisterHealthChecks())
+
+	ctx := context.Background()
+	readiness := registry.Aggregate(ctx, core.Readiness)
+	assert.True(t, readiness.OK)
+	assert.Contains(t, readiness.Details, "db-primary-readiness")
+
+	liveness := registry.Aggregate(ctx, core.Liveness)
+	assert.True(t, liveness.OK)
+	assert.Contains(t, liveness.Details, "db-primary-liveness")
+}
+
+func TestHealthChecker_Config(t *testing.T) {
+	ctx := context.Background()
+
+	newChecker := func(t *testing.T, health HealthConfig) core.Registry {
+		registry := core.NewHealthRegistry()
+		cfg := &Config{Databases: map[string]*DatabaseConfig{"reports": {Health: health}}}
+		hc := NewHealthChecker(Connections{"reports": setupTestDB(t)}, registry, WithHealthConfig(cfg))
+		require.NoError(t, hc.RegisterHealthChecks())
+		return registry
+	}
+
+	t.Run("disable readiness", func(t *testing.T) {
+		registry := newChecker(t, HealthConfig{DisableReadiness: true})
+		assert.Empty(t, registry.Aggregate(ctx, core.Readiness).Details)
+		assert.Contains(t, registry.Aggregate(ctx, core.Liveness).Details, "db-reports-liveness")
+	})
+
+	t.Run("disable liveness", func(t *testing.T) {
+		registry := newChecker(t, HealthConfig{DisableLiveness: true})
+		assert.Contains(t, registry.Aggregate(ctx, core.Readiness).Details, "db-reports-readiness")
+		assert.Empty(t, registry.Aggregate(ctx, core.Liveness).Details)
+	})
+
+	t.Run("custom query and expected result", func(t *testing.T) {
+		registry := newChecker(t, HealthConfig{Query: "SELECT 'ok'", ExpectedResult: "ok"})
+		assert.True(t, registry.Aggregate(ctx, core.Liveness).OK)
+	})
+
+	t.Run("unexpected result", func(t *testing.T) {
+		registry := newChecker(t, HealthConfig{Query: "SELECT 2", ExpectedResult: "1"})
+		result := registry.Aggregate(ctx, core.Liveness)
+		assert.False(t, result.OK)
+		assert.Contains(t, result.Details["db-reports-liveness"].Error, "unexpected result")
+	})
+
+	t.Run("custom query without expectation", func(t *testing.T) {
+		registry := newChecker(t, HealthConfig{Query: "SELECT 42"})
+		assert.True(t, registry.Aggregate(ctx, core.Liveness).OK)
+	})
+}
+
+func TestHealthConfig_WithDefaults(t *testing.T) {
+	cfg := HealthConfig{}.withDefaults()
+	assert.Equal(t, 3*time.Second, cfg.ReadinessTimeout)
+	assert.Equal(t, 5*time.Second, cfg.LivenessTimeout)
+	assert.Equal(t, "SELECT 1", cfg.Query)
+	assert.Equal(t, "1", cfg.ExpectedResult)
+
+	custom := HealthConfig{Query: "SELECT version()", LivenessTimeout: time.Second}.withDefaults()
+	assert.Equal(t, "SELECT version()", custom.Query)
+	assert.Empty(t, custom.ExpectedResult)
+	assert.Equal(t, time.Second, custom.LivenessTimeout)
+
+	invalid := HealthConfig{ExpectedResult: "1"}
+	assert.Error(t, invalid.Validate())
+}
+
+func TestHealthConfig_PoolWaitThresholds(t *testing.T) {
+	cfg := HealthConfig{}.withDefaults()
+	assert.Equal(t, time.Second, cfg.PoolMaxWaitDuration)
+	assert.Zero(t, cfg.PoolMaxWaitCount)
+
+	countOnly := HealthConfig{PoolMaxWaitCount: 5, PoolMaxWaitDuration: -1}.withDefaults()
+	require.NoError(t, countOnly.Validate())
+	assert.Equal(t, time.Duration(-1), countOnly.PoolMaxWaitDuration)
+
+	// Long waits no longer fail the check once the duration threshold is disabled
+	prev := sql.DBStats{MaxOpenConnections: 1, InUse: 1}
+	cur := sql.DBStats{MaxOpenConnections: 1, InUse: 1, WaitCount: 1, WaitDuration: time.Hour}
+	assert.NoError(t, detectPoolSaturation(prev, cur, countOnly))
+	assert.Error(t, detectPoolSaturation(prev, cur, cfg))
+
+	negative := HealthConfig{PoolMaxWaitCount: -1}
+	assert.Error(t, negative.Validate())
+}
+
+func TestDetectPoolSaturation(t *testing.T) {
+	cfg := HealthConfig{PoolSaturationRatio: 1, PoolMaxWaitCount: 5, PoolMaxWaitDuration: time.Second}
+	base := sql.DBStats{MaxOpenConnections: 10, InUse: 10, WaitCount: 100, WaitDuration: time.Minute}
+
+	tests := []struct {
+		name   string
+		cur    sql.DBStats
+		cfg    HealthConfig
+		errMsg string
+	}{
+		{
+			name: "no new waits",
+			cur:  base,
+			cfg:  cfg,
+		},
+		{
+			name:   "wait count exceeded",
+			cur:    sql.DBStats{MaxOpenConnections: 10, InUse: 10, OpenConnections: 10, WaitCount: 105, WaitDuration: time.Minute},
+			cfg:    cfg,
+			errMsg: "10/10 connections in use (100%), 5 waits",
+		},
+		{
+			name:   "wait duration exceeded",
+			cur:    sql.DBStats{MaxOpenConnections: 10, InUse: 10, WaitCount: 101, WaitDuration: time.Minute + 2*time.Second},
+			cfg:    cfg,
+			errMsg: "1 waits totalling 2s",
+		},
+		{
+			name: "below thresholds",
+			cur:  sql.DBStats{MaxOpenConnections: 10, InUse: 10, WaitCount: 102, WaitDuration: time.Minute + time.Millisecond},
+			cfg:  cfg,
+		},
+		{
+			name: "pool not full",
+			cur:  sql.DBStats{MaxOpenConnections: 10, InUse: 7, WaitCount: 200, WaitDuration: time.Hour},
+			cfg:  cfg,
+		},
+		{
+			name:   "lower saturation ratio",
+			cur:    sql.DBStats{MaxOpenConnections: 10, InUse: 8, WaitCount: 200, WaitDuration: time.Hour},
+			cfg:    HealthConfig{PoolSaturationRatio: 0.8, PoolMaxWaitCount: 5},
+			errMsg: "8/10 connections in use (80%)",
+		},
+		{
+			name: "unlimited pool",
+			cur:  sql.DBStats{MaxOpenConnections: 0, InUse: 50, WaitCount: 200, WaitDuration: time.Hour},
+			cfg:  cfg,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := detectPoolSaturation(base, tt.cur, tt.cfg)
+			if tt.errMsg == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg)
+		})
+	}
+}
+
+func TestLivenessCheck_PoolStarvation(t *testing.T) {
+	db := setupTestDB(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	hc := NewHealthChecker(Connections{"primary": db}, nil)
+	check := hc.createLivenessCheck(db, HealthConfig{PoolMaxWaitCount: 1, LivenessTimeout: time.Second}.withDefaults())
+	ctx := context.Background()
+	require.NoError(t, check(ctx))
+
+	// Hold the only connection and make another caller wait for it
+	conn, err := sqlDB.Conn(ctx)
+	require.NoError(t, err)
+	waitCtx, cancel := context.WithTimeout(ctx, 20*time.Millisecond)
+	defer cancel()
+	_, err = sqlDB.ExecContext(waitCtx, "SELECT 1")
+	require.Error(t, err)
+
+	err = check(ctx)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "connection pool saturated")
+
+	// Recovered once the connection is released and no new waits occur
+	require.NoError(t, conn.Close())
+	assert.NoError(t, check(ctx))
+}
+
+func TestMigrationReadinessCheck(t *testing.T) {
+	ctx := context.Background()
+
+	newRegistry := func(t *testing.T, status migrate.Status, statusErr error) core.Registry {
+		registry := core.NewHealthRegistry()
+		cfg := &Config{Databases: map[string]*DatabaseConfig{
+			"primary": {MigrationSource: "file://migrations", Health: HealthConfig{MigrationCheck: true}},
+		}}
+		hc := NewHealthChecker(Connections{"primary": setupTestDB(t)}, registry, WithHealthConfig(cfg))
+		hc.migrationStatus = func(ctx context.Context, db *gorm.DB, dbCfg *DatabaseConfig) (migrate.Status, error) {
+			assert.Equal(t, "file://migrations", dbCfg.MigrationSource)
+			return status, statusErr
+		}
+		require.NoError(t, hc.RegisterHealthChecks())
+		return registry
+	}
+
+	tests := []struct {
+		name    string
+		status  migrate.Status
+		err     error
+		wantErr string
+	}{
+		{name: "up to date", status: migrate.Status{Current: 3, Latest: 3}},
+		{name: "dirty", status: migrate.Status{Current: 3, Latest: 3, Dirty: true}, wantErr: "schema is dirty at migration version 3"},
+		{name: "behind", status: migrate.Status{Current: 1, Latest: 3, Pending: []uint{2, 3}}, wantErr: "behind latest version 3 (2 pending)"},
+		{name: "status error", err: errors.New("connection refused"), wantErr: "connection refused"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := newRegistry(t, tt.status, tt.err).Aggregate(ctx, core.Readiness)
+			detail, ok := result.Details["db-primary-migrations"]
+			require.True(t, ok)
+			if tt.wantErr == "" {
+				assert.True(t, detail.OK)
+				return
+			}
+			assert.False(t, result.OK)
+			assert.Contains(t, detail.Error, tt.wantErr)
+		})
+	}
+
+	t.Run("requires migration source", func(t *testing.T) {
+		dbCfg := &DatabaseConfig{Driver: "postgres", DSN: "postgres://localhost/app", Health: HealthConfig{MigrationCheck: true}}
+		assert.ErrorContains(t, dbCfg.Validate(), "migration_check requires migration_source")
+	})
+}
+
+func TestMigrationStatusReaderIsShared(t *testing.T) {
+	db := setupTestDB(t)
+	dbCfg := &DatabaseConfig{Driver: "postgres", DSN: "postgres://app@127.0.0.1:1/app", MigrationSource: "file://" + t.TempDir()}
+	registerState(t, "primary", db, &connectionState{migration: &migrationStatus{dbCfg: dbCfg}})
+
+	// The reader outlives failed reads and reconnects on the next probe
+	_, err := migrationStatusFor(context.Background(), db, dbCfg)
+	require.Error(t, err)
+	reader := migrationStatusOf(db).reader
+	require.NotNil(t, reader)
+
+	_, err = migrationStatusFor(context.Background(), db, dbCfg)
+	require.Error(t, err)
+	assert.Same(t, reader, migrationStatusOf(db).reader)
+
+	require.NoError(t, closeMigrationStatus(db))
+	assert.Nil(t, migrationStatusOf(db).reader)
+}
+
+func TestCachedProbe(t *testing.T) {
+	t.Run("concurrent callers share one run", func(t *testing.T) {
+		var calls atomic.Int32
+		release := make(chan struct{})
+		probe := newCachedProbe(func(ctx context.Context) error {
+			calls.Add(1)
+			<-release
+			return errors.New("down")
+		}, 0)
+
+		var wg sync.WaitGroup
+		errs := make(chan error, 10)
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				errs <- probe.check(context.Background())
+			}()
+		}
+
+		// Wait until the shared run has started before releasing it
+		require.Eventually(t, func() bool { return calls.Load() == 1 }, time.Second, time.Millisecond)
+		time.Sleep(10 * time.Millisecond)
+		close(release)
+		wg.Wait()
+		close(errs)
+
+		assert.Equal(t, int32(1), calls.Load())
+		for err := range errs {
+			assert.EqualError(t, err, "down")
+		}
+	})
+
+	t.Run("caches result for ttl", func(t *testing.T) {
+		var calls atomic.Int32
+		now := time.Now()
+		probe := newCachedProbe(func(ctx context.Context) error {
+			calls.Add(1)
+			return nil
+		}, time.Second)
+		probe.now = func() time.Time { return now }
+
+		ctx := context.Background()
+		require.NoError(t, probe.check(ctx))
+		require.NoError(t, probe.check(ctx))
+		assert.Equal(t, int32(1), calls.Load())
+
+		now = now.Add(2 * time.Second)
+		require.NoError(t, probe.check(ctx))
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("no caching without ttl", func(t *testing.T) {
+		var calls atomic.Int32
+		probe := newCachedProbe(func(ctx context.Context) error {
+			calls.Add(1)
+			return nil
+		}, 0)
+
+		ctx := context.Background()
+		require.NoError(t, probe.check(ctx))
+		require.NoError(t, probe.check(ctx))
+		assert.Equal(t, int32(2), calls.Load())
+	})
+
+	t.Run("cancelled caller does not cancel the shared run", func(t *testing.T) {
+		release := make(chan struct{})
+		var probeErr atomic.Value
+		probe := newCachedProbe(func(ctx context.Context) error {
+			<-release
+			if err := ctx.Err(); err != nil {
+				probeErr.Store(err)
+			}
+			return nil
+		}, time.Minute)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		assert.ErrorIs(t, probe.check(ctx), context.Canceled)
+
+		close(release)
+		require.Eventually(t, func() bool {
+			probe.mu.Lock()
+			defer probe.mu.Unlock()
+			return probe.hasResult
+		}, time.Second, time.Millisecond)
+		assert.Nil(t, probeErr.Load())
+		assert.NoError(t, probe.check(context.Background()))
+	})
+}
+
+func TestCustomHealthChecks(t *testing.T) {
+	ctx := context.Background()
+	db := setupTestDB(t)
+	// Checks run concurrently; keep them on the in-memory database holding the table
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, db.Exec("CREATE TABLE jobs (id INTEGER PRIMARY KEY, state TEXT)").Error)
+	require.NoError(t, db.Exec("INSERT INTO jobs (state) VALUES ('queued'), ('queued'), ('done')").Error)
+
+	backlogBelow := func(limit int64) func(ctx context.Context, db *gorm.DB) error {
+		return func(ctx context.Context, db *gorm.DB) error {
+			var backlog int64
+			if err := db.Table("jobs").Where("state = ?", "queued").Count(&backlog).Error; err != nil {
+				return err
+			}
+			if backlog >= limit {
+				return fmt.Errorf("job backlog %d exceeds %d", backlog, limit)
+			}
+			return nil
+		}
+	}
+
+	registry := core.NewHealthRegistry()
+	hc := NewHealthChecker(Connections{"primary": db}, registry, WithCustomHealthChecks(
+		HealthCheckFunc("job-backlog", "primary", core.Readiness, backlogBelow(10)),
+		HealthCheckFunc("job-backlog-critical", "primary", core.Liveness, backlogBelow(2)),
+	))
+	require.NoError(t, hc.RegisterHealthChecks())
+
+	readiness := registry.Aggregate(ctx, core.Readiness)
+	assert.True(t, readiness.Details["db-primary-job-backlog"].OK)
+	assert.Contains(t, readiness.Details, "db-primary-readiness", "registered alongside built-in checks")
+
+	liveness := registry.Aggregate(ctx, core.Liveness)
+	assert.False(t, liveness.OK)
+	assert.Equal(t, "job backlog 2 exceeds 2", liveness.Details["db-primary-job-backlog-critical"].Error)
+
+	t.Run("unknown database", func(t *testing.T) {
+		registry := core.NewHealthRegistry()
+		hc := NewHealthChecker(Connections{"primary": db}, registry, WithCustomHealthChecks(
+			HealthCheckFunc("partitions", "analytics", core.Readiness, backlogBelow(1)),
+			HealthCheckFunc("job-backlog", "primary", core.Readiness, backlogBelow(10)),
+		))
+		assert.ErrorContains(t, hc.RegisterHealthChecks(), "database 'analytics' not found")
+
+		details := registry.Aggregate(ctx, core.Readiness).Details
+		assert.Contains(t, details, "db-primary-readiness", "built-in checks are registered regardless")
+		assert.Contains(t, details, "db-primary-job-backlog", "valid custom checks are registered")
+		assert.Len(t, details, 2)
+	})
+
+	t.Run("invalid kind and duplicate name", func(t *testing.T) {
+		hc := NewHealthChecker(Connections{"primary": db}, core.NewHealthRegistry(), WithCustomHealthChecks(
+			HealthCheckFunc("partitions", "primary", core.Kind("startup"), backlogBelow(1)),
+			HealthCheckFunc("readiness", "primary", core.Readiness, backlogBelow(1)),
+		))
+		err := hc.RegisterHealthChecks()
+		assert.ErrorContains(t, err, "unknown kind")
+		assert.ErrorContains(t, err, "a check named 'db-primary-readiness' is already registered")
+	})
+}
@@ -0,0 +1,353 @@
+package dbx
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gostratum/core/logx"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// ErrUnknownDatabase is returned when a database name is not configured
+var ErrUnknownDatabase = errors.New("database not found in configured databases")
+
+// DefaultLogLevelTTL is how long a runtime log level change lasts when no TTL is given
+const DefaultLogLevelTTL = 15 * time.Minute
+
+// logLevelNames maps configuration names to GORM log levels
+var logLevelNames = map[string]gormlogger.LogLevel{
+	"silent": gormlogger.Silent,
+	"error":  gormlogger.Error,
+	"warn":   gormlogger.Warn,
+	"info":   gormlogger.Info,
+}
+
+// parseLogLevel converts a configured log level name
+func parseLogLevel(name string) (gormlogger.LogLevel, bool) {
+	level, ok := logLevelNames[name]
+	return level, ok
+}
+
+// logLevelName converts a GORM log level to its configuration name
+func logLevelName(level gormlogger.LogLevel) string {
+	for name, l := range logLevelNames {
+		if l == level {
+			return name
+		}
+	}
+	return fmt.Sprintf("%d", level)
+}
+
+// logSettings holds the log level and slow threshold of a GORM logger. They
+// can be changed at runtime and revert to their defaults after a TTL.
+type logSettings struct {
+	current atomic.Int32
+	slow    atomic.Int64
+
+	defaultLevel gormlogger.LogLevel
+	defaultSlow  time.Duration
+	logger       logx.Logger
+
+	mu      sync.Mutex
+	expires time.Time
+	revert  *time.Timer
+}
+
+func newLogSettings(level gormlogger.LogLevel, slowThreshold time.Duration, logger logx.Logger) *logSettings {
+	s := &logSettings{defaultLevel: level, defaultSlow: slowThreshold, logger: logger}
+	s.current.Store(int32(level))
+	s.slow.Store(int64(slowThreshold))
+	return s
+}
+
+func (s *logSettings) level() gormlogger.LogLevel {
+	return gormlogger.LogLevel(s.current.Load())
+}
+
+func (s *logSettings) slowThreshold() time.Duration {
+	return time.Duration(s.slow.Load())
+}
+
+// set changes the level and slow threshold until ttl has passed
+func (s *logSettings) set(level gormlogger.LogLevel, slowThreshold, ttl time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.revert != nil {
+		s.revert.Stop()
+	}
+	s.current.Store(int32(level))
+	s.slow.Store(int64(slowThreshold))
+	s.expires = time.Now().Add(ttl)
+
+	var timer *time.Timer
+	timer = time.AfterFunc(ttl, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// A later change has replaced this timer
+		if s.revert != timer {
+			return
+		}
+		s.resetLocked()
+		s.logger.Info("Reverted SQL log level",
+			logx.String("level", logLevelName(s.defaultLevel)),
+			logx.Duration("slow_threshold", s.defaultSlow),
+		)
+	})
+	s.revert = timer
+
+	s.logger.Info("Changed SQL log level",
+		logx.String("level", logLevelName(level)),
+		logx.Duration("slow_threshold", slowThreshold),
+		logx.Duration("ttl", ttl),
+	)
+}
+
+// reset restores the defaults
+func (s *logSettings) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.revert != nil {
+		s.revert.Stop()
+	}
+	s.resetLocked()
+}
+
+func (s *logSettings) resetLocked() {
+	s.current.Store(int32(s.defaultLevel))
+	s.slow.Store(int64(s.defaultSlow))
+	s.expires = time.Time{}
+	s.revert = nil
+}
+
+// state describes the current settings
+func (s *logSettings) state() LogLevelState {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := LogLevelState{
+		Level:                logLevelName(s.level()),
+		SlowThreshold:        s.slowThreshold(),
+		DefaultLevel:         logLevelName(s.defaultLevel),
+		DefaultSlowThreshold: s.defaultSlow,
+	}
+	if !s.expires.IsZero() {
+		expires := s.expires
+		state.ExpiresAt = &expires
+	}
+	return state
+}
+
+// LogLevelState describes the SQL log settings of a database
+type LogLevelState struct {
+	Level                string        `json:"level"`
+	SlowThreshold        time.Duration `json:"slow_threshold"`
+	DefaultLevel         string        `json:"default_level"`
+	DefaultSlowThreshold time.Duration `json:"default_slow_threshold"`
+	ExpiresAt            *time.Time    `json:"expires_at,omitempty"`
+}
+
+// LogLevelChange is a temporary change of a database's SQL log settings
+type LogLevelChange struct {
+	// Level is silent, error, warn or info; empty keeps the current level
+	Level string
+	// SlowThreshold replaces the slow query threshold when set
+	SlowThreshold *time.Duration
+	// TTL is how long the change lasts (DefaultLogLevelTTL when <= 0)
+	TTL time.Duration
+}
+
+// LogLevelController changes the GORM log level and slow threshold of
+// connections at runtime. Changes revert automatically after their TTL.
+type LogLevelController struct {
+	connections Connections
+}
+
+// NewLogLevelController creates a controller for the connections
+func NewLogLevelController(connections Connections) *LogLevelController {
+	return &LogLevelController{connections: connections}
+}
+
+// settings returns the runtime settings of a database's logger
+func (c *LogLevelController) settings(database string) (*logSettings, error) {
+	db, ok := c.connections[database]
+	if !ok {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownDatabase, database)
+	}
+	l, ok := db.Logger.(*gormLoggerAdapter)
+	if !ok {
+		return nil, fmt.Errorf("database %s does not use the dbx logger", database)
+	}
+	return l.settings, nil
+}
+
+// Set applies a temporary change to a database's SQL log settings
+func (c *LogLevelController) Set(database string, change LogLevelChange) (LogLevelState, error) {
+	s, err := c.settings(database)
+	if err != nil {
+		return LogLevelState{}, err
+	}
+
+	level := s.level()
+	if change.Level != "" {
+		var ok bool
+		if level, ok = parseLogLevel(change.Level); !ok {
+			return LogLevelState{}, fmt.Errorf("invalid log level %q: must be one of silent, error, warn, info", change.Level)
+		}
+	}
+
+	slow := s.slowThreshold()
+	if change.SlowThreshold != nil {
+		if *change.SlowThreshold < 0 {
+			return LogLevelState{}, fmt.Errorf("slow_threshold must be >= 0")
+		}
+		slow = *change.SlowThreshold
+	}
+
+	ttl := change.TTL
+	if ttl <= 0 {
+		ttl = DefaultLogLevelTTL
+	}
+
+	s.set(level, slow, ttl)
+	return s.state(), nil
+}
+
+// Reset restores a database's configured SQL log settings
+func (c *LogLevelController) Reset(database string) (LogLevelState, error) {
+	s, err := c.settings(database)
+	if err != nil {
+		return LogLevelState{}, err
+	}
+	s.reset()
+	return s.state(), nil
+}
+
+// Get returns a database's current SQL log settings
+func (c *LogLevelController) Get(database string) (LogLevelState, error) {
+	s, err := c.settings(database)
+	if err != nil {
+		return LogLevelState{}, err
+	}
+	return s.state(), nil
+}
+
+// States returns the SQL log settings of every database using the dbx logger
+func (c *LogLevelController) States() map[string]LogLevelState {
+	out := make(map[string]LogLevelState, len(c.connections))
+	for name := range c.connections {
+		if state, err := c.Get(name); err == nil {
+			out[name] = state
+		}
+	}
+	return out
+}
+
+// LogLevelHandler serves the LogLevelController over HTTP:
+//
+//	GET    lists the settings of every database
+//	PUT    applies {"database", "level", "slow_threshold", "ttl"}
+//	DELETE ?database=name restores the configured settings
+type LogLevelHandler struct {
+	controller *LogLevelController
+	authorize  func(r *http.Request) bool
+}
+
+// LogLevelHandlerOption configures a LogLevelHandler
+type LogLevelHandlerOption func(*LogLevelHandler)
+
+// WithLogLevelAuth admits only requests for which authorize returns true.
+// Without it the handler rejects every request: raising a database to info
+// logs every statement with its parameters.
+func WithLogLevelAuth(authorize func(r *http.Request) bool) LogLevelHandlerOption {
+	return func(h *LogLevelHandler) {
+		h.authorize = authorize
+	}
+}
+
+// NewLogLevelHandler creates an HTTP handler for the controller
+func NewLogLevelHandler(controller *LogLevelController, opts ...LogLevelHandlerOption) *LogLevelHandler {
+	h := &LogLevelHandler{controller: controller}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+// logLevelRequest is the body of a PUT request
+type logLevelRequest struct {
+	Database      string  `json:"database"`
+	Level         string  `json:"level"`
+	SlowThreshold *string `json:"slow_threshold"`
+	TTL           string  `json:"ttl"`
+}
+
+// ServeHTTP implements http.Handler
+func (h *LogLevelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.authorize == nil || !h.authorize(r) {
+		writeJSON(w, http.StatusForbidden, map[string]string{"error": "forbidden"})
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+		writeJSON(w, http.StatusOK, h.controller.States())
+	case http.MethodPut:
+		var req logLevelRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": fmt.Sprintf("invalid body: %v", err)})
+			return
+		}
+		change, err := req.change()
+		if err != nil {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+			return
+		}
+		h.respond(w, req.Database)(h.controller.Set(req.Database, change))
+	case http.MethodDelete:
+		database := r.URL.Query().Get("database")
+		h.respond(w, database)(h.controller.Reset(database))
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT, DELETE")
+		writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": "method not allowed"})
+	}
+}
+
+// respond writes the resulting state of database, or the error
+func (h *LogLevelHandler) respond(w http.ResponseWriter, database string) func(LogLevelState, error) {
+	return func(state LogLevelState, err error) {
+		switch {
+		case err == nil:
+			writeJSON(w, http.StatusOK, map[string]LogLevelState{database: state})
+		case errors.Is(err, ErrUnknownDatabase):
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+		default:
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": err.Error()})
+		}
+	}
+}
+
+// change converts the request into a LogLevelChange
+func (req logLevelRequest) change() (LogLevelChange, error) {
+	change := LogLevelChange{Level: req.Level}
+	if req.SlowThreshold != nil {
+		d, err := time.ParseDuration(*req.SlowThreshold)
+		if err != nil {
+			return change, fmt.Errorf("invalid slow_threshold: %w", err)
+		}
+		change.SlowThreshold = &d
+	}
+	if req.TTL != "" {
+		d, err := time.ParseDuration(req.TTL)
+		if err != nil {
+			return change, fmt.Errorf("invalid ttl: %w", err)
+		}
+		change.TTL = d
+	}
+	return change, nil
+}
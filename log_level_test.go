@@ -0,0 +1,118 @@
+package dbx
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func setupLogLevelController(t *testing.T) (*LogLevelController, *gorm.DB, *recordingLogger) {
+	logger := newRecordingLogger()
+	gormLogger := NewGormLogger(logger, "warn", time.Second)
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormLogger})
+	require.NoError(t, err)
+	return NewLogLevelController(Connections{"primary": db}), db, logger
+}
+
+func TestLogLevelController(t *testing.T) {
+	controller, db, logger := setupLogLevelController(t)
+
+	require.NoError(t, db.Exec("SELECT 1").Error)
+	assert.Empty(t, logger.find("SQL query executed"))
+
+	slow := 50 * time.Millisecond
+	state, err := controller.Set("primary", LogLevelChange{Level: "info", SlowThreshold: &slow, TTL: time.Hour})
+	require.NoError(t, err)
+	assert.Equal(t, "info", state.Level)
+	assert.Equal(t, slow, state.SlowThreshold)
+	assert.Equal(t, "warn", state.DefaultLevel)
+	require.NotNil(t, state.ExpiresAt)
+
+	require.NoError(t, db.Exec("SELECT 1").Error)
+	assert.Len(t, logger.find("SQL query executed"), 1)
+
+	state, err = controller.Reset("primary")
+	require.NoError(t, err)
+	assert.Equal(t, "warn", state.Level)
+	assert.Equal(t, time.Second, state.SlowThreshold)
+	assert.Nil(t, state.ExpiresAt)
+
+	_, err = controller.Set("primary", LogLevelChange{Level: "verbose"})
+	assert.Error(t, err)
+	_, err = controller.Get("missing")
+	assert.ErrorIs(t, err, ErrUnknownDatabase)
+}
+
+func TestLogLevelController_Reverts(t *testing.T) {
+	controller, _, logger := setupLogLevelController(t)
+
+	_, err := controller.Set("primary", LogLevelChange{Level: "info", TTL: 20 * time.Millisecond})
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		state, err := controller.Get("primary")
+		return err == nil && state.Level == "warn" && state.ExpiresAt == nil
+	}, time.Second, 5*time.Millisecond)
+	assert.Len(t, logger.find("Reverted SQL log level"), 1)
+}
+
+func TestLogLevelHandler(t *testing.T) {
+	controller, _, _ := setupLogLevelController(t)
+	h := NewLogLevelHandler(controller, WithLogLevelAuth(func(r *http.Request) bool {
+		return r.Header.Get("X-Admin") == "yes"
+	}))
+
+	do := func(method, target, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, strings.NewReader(body))
+		req.Header.Set("X-Admin", "yes")
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do(http.MethodPut, "/debug/db/log-level", `{"database":"primary","level":"info","slow_threshold":"10ms","ttl":"5m"}`)
+	require.Equal(t, http.StatusOK, rec.Code, rec.Body.String())
+	var states map[string]LogLevelState
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &states))
+	assert.Equal(t, "info", states["primary"].Level)
+	assert.Equal(t, 10*time.Millisecond, states["primary"].SlowThreshold)
+
+	rec = do(http.MethodGet, "/debug/db/log-level", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &states))
+	assert.Equal(t, "info", states["primary"].Level)
+
+	rec = do(http.MethodDelete, "/debug/db/log-level?database=primary", "")
+	require.Equal(t, http.StatusOK, rec.Code)
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &states))
+	assert.Equal(t, "warn", states["primary"].Level)
+
+	assert.Equal(t, http.StatusNotFound, do(http.MethodPut, "/", `{"database":"missing","level":"info"}`).Code)
+	assert.Equal(t, http.StatusBadRequest, do(http.MethodPut, "/", `{"database":"primary","ttl":"soon"}`).Code)
+	assert.Equal(t, http.StatusMethodNotAllowed, do(http.MethodPost, "/", "").Code)
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+}
+
+func TestLogLevelHandler_DeniesWithoutAuthorizer(t *testing.T) {
+	controller, _, _ := setupLogLevelController(t)
+	h := NewLogLevelHandler(controller)
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"database":"primary","level":"info"}`)))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	state, err := controller.Get("primary")
+	require.NoError(t, err)
+	assert.Equal(t, "warn", state.Level)
+}
@@ -0,0 +1,253 @@
+package dbx
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/gostratum/core/logx"
+)
+
+const (
+	// maxSampledFingerprints bounds the number of query shapes tracked by the
+	// sampler; further shapes share a single window
+	maxSampledFingerprints = 1000
+	// overflowFingerprint is the shared window used once the bound is reached
+	overflowFingerprint = "other"
+	// defaultLogSampleInterval is used when no interval is configured
+	defaultLogSampleInterval = time.Minute
+)
+
+// WithLogSampling limits slow query and error logs to burst entries per query
+// fingerprint per interval. Suppressed entries are reported in a summary once
+// the interval has passed, and pending summaries are logged when the module
+// stops. A burst <= 0 disables sampling; an interval <= 0
+// defaults to one minute.
+func WithLogSampling(burst int, interval time.Duration) GormLoggerOption {
+	return func(l *gormLoggerAdapter) {
+		if burst <= 0 {
+			l.sampler = nil
+			return
+		}
+		if interval <= 0 {
+			interval = defaultLogSampleInterval
+		}
+		l.sampler = newLogSampler(burst, interval)
+	}
+}
+
+// logSampler rate-limits log entries per level and query fingerprint
+type logSampler struct {
+	burst    int
+	interval time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	windows   map[sampleKey]*sampleWindow
+	nextSweep time.Time
+
+	// runMu guards stop, which is set while the flush goroutine runs
+	runMu sync.Mutex
+	stop  chan struct{}
+}
+
+type sampleKey struct {
+	level       string
+	fingerprint string
+}
+
+type sampleWindow struct {
+	shape      string
+	start      time.Time
+	count      int
+	suppressed int
+}
+
+// suppressedLogs summarizes the entries dropped during one window
+type suppressedLogs struct {
+	level       string
+	fingerprint string
+	shape       string
+	suppressed  int
+	since       time.Time
+}
+
+func newLogSampler(burst int, interval time.Duration) *logSampler {
+	return &logSampler{
+		burst:    burst,
+		interval: interval,
+		now:      time.Now,
+		windows:  make(map[sampleKey]*sampleWindow),
+	}
+}
+
+// allow reports whether an entry may be logged, along with the summaries of
+// windows that have ended since the last call
+func (s *logSampler) allow(level, fingerprint, shape string) (bool, []suppressedLogs) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	var ended []suppressedLogs
+	if !now.Before(s.nextSweep) {
+		ended = s.sweep(now)
+		s.nextSweep = now.Add(s.interval)
+	}
+
+	key := sampleKey{level: level, fingerprint: fingerprint}
+	w, ok := s.windows[key]
+	if !ok && len(s.windows) >= maxSampledFingerprints {
+		key.fingerprint = overflowFingerprint
+		shape = ""
+		w, ok = s.windows[key]
+	}
+	if ok && now.Sub(w.start) >= s.interval {
+		if w.suppressed > 0 {
+			ended = append(ended, w.summary(key))
+		}
+		ok = false
+	}
+	if !ok {
+		w = &sampleWindow{shape: shape, start: now}
+		s.windows[key] = w
+	}
+
+	if w.count < s.burst {
+		w.count++
+		return true, ended
+	}
+	w.suppressed++
+	return false, ended
+}
+
+// summary describes the entries the window suppressed
+func (w *sampleWindow) summary(key sampleKey) suppressedLogs {
+	return suppressedLogs{level: key.level, fingerprint: key.fingerprint, shape: w.shape, suppressed: w.suppressed, since: w.start}
+}
+
+// sweep removes ended windows and returns those that suppressed entries
+func (s *logSampler) sweep(now time.Time) []suppressedLogs {
+	var ended []suppressedLogs
+	for key, w := range s.windows {
+		if now.Sub(w.start) < s.interval {
+			continue
+		}
+		if w.suppressed > 0 {
+			ended = append(ended, w.summary(key))
+		}
+		delete(s.windows, key)
+	}
+	return ended
+}
+
+// flushEnded removes ended windows and returns those that suppressed entries
+func (s *logSampler) flushEnded() []suppressedLogs {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	s.nextSweep = now.Add(s.interval)
+	return s.sweep(now)
+}
+
+// drain removes every window and returns those that suppressed entries
+func (s *logSampler) drain() []suppressedLogs {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var pending []suppressedLogs
+	for key, w := range s.windows {
+		if w.suppressed > 0 {
+			pending = append(pending, w.summary(key))
+		}
+	}
+	s.windows = make(map[sampleKey]*sampleWindow)
+	return pending
+}
+
+// startSampling periodically logs the summaries of ended windows, so they are
+// not held back until the same query shape is logged again
+func (l *gormLoggerAdapter) startSampling() {
+	s := l.sampler
+	if s == nil {
+		return
+	}
+
+	s.runMu.Lock()
+	defer s.runMu.Unlock()
+	if s.stop != nil {
+		return
+	}
+	s.stop = make(chan struct{})
+	go l.flushPeriodically(s.stop, s.interval)
+}
+
+// stopSampling stops the flush goroutine and logs all pending summaries
+func (l *gormLoggerAdapter) stopSampling() {
+	s := l.sampler
+	if s == nil {
+		return
+	}
+
+	s.runMu.Lock()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+	s.runMu.Unlock()
+
+	l.logSuppressed(s.drain())
+}
+
+// flushPeriodically logs the summaries of ended windows every interval
+func (l *gormLoggerAdapter) flushPeriodically(stop <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			l.logSuppressed(l.sampler.flushEnded())
+		case <-stop:
+			return
+		}
+	}
+}
+
+// sampled reports whether a slow query or error entry should be logged and
+// logs summaries for windows that suppressed entries
+func (l *gormLoggerAdapter) sampled(level, shape, fingerprint string) bool {
+	if l.sampler == nil {
+		return true
+	}
+
+	allowed, ended := l.sampler.allow(level, fingerprint, shape)
+	l.logSuppressed(ended)
+	return allowed
+}
+
+// logSuppressed logs a summary for each window that suppressed entries
+func (l *gormLoggerAdapter) logSuppressed(ended []suppressedLogs) {
+	for _, e := range ended {
+		fields := []logx.Field{
+			logx.String("fingerprint", e.fingerprint),
+			logx.String("sql", e.shape),
+			logx.Int("suppressed", e.suppressed),
+			logx.Duration("window", time.Since(e.since)),
+		}
+		if e.level == "error" {
+			l.logger.Error("Suppressed repeated SQL error logs", fields...)
+		} else {
+			l.logger.Warn("Suppressed repeated slow SQL logs", fields...)
+		}
+	}
+}
+
+// statementSQL returns the statement with placeholders captured when it ran,
+// and the SQL passed to Trace when none was captured
+func (l *gormLoggerAdapter) statementSQL(ctx context.Context, explained string) string {
+	if stmt := statementFromContext(ctx); stmt != nil && stmt.sql != "" {
+		return stmt.sql
+	}
+	return explained
+}
@@ -0,0 +1,116 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestLogSampler(t *testing.T) {
+	now := time.Unix(0, 0)
+	s := newLogSampler(2, time.Minute)
+	s.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		allowed, ended := s.allow("warn", "q1", "SELECT ?")
+		assert.True(t, allowed)
+		assert.Empty(t, ended)
+	}
+	for i := 0; i < 3; i++ {
+		allowed, _ := s.allow("warn", "q1", "SELECT ?")
+		assert.False(t, allowed)
+	}
+
+	// Other shapes and levels have their own windows
+	allowed, _ := s.allow("error", "q1", "SELECT ?")
+	assert.True(t, allowed)
+	allowed, _ = s.allow("warn", "q2", "SELECT ? FROM t")
+	assert.True(t, allowed)
+
+	now = now.Add(time.Minute)
+	allowed, ended := s.allow("warn", "q2", "SELECT ? FROM t")
+	assert.True(t, allowed)
+	require.Len(t, ended, 1)
+	assert.Equal(t, suppressedLogs{level: "warn", fingerprint: "q1", shape: "SELECT ?", suppressed: 3, since: time.Unix(0, 0)}, ended[0])
+}
+
+func TestLogSampler_BoundsFingerprints(t *testing.T) {
+	s := newLogSampler(1, time.Minute)
+	for i := 0; i < maxSampledFingerprints; i++ {
+		allowed, _ := s.allow("warn", fmt.Sprintf("q%d", i), "")
+		require.True(t, allowed)
+	}
+
+	allowed, _ := s.allow("warn", "new-1", "")
+	assert.True(t, allowed)
+	allowed, _ = s.allow("warn", "new-2", "")
+	assert.False(t, allowed)
+	assert.Len(t, s.windows, maxSampledFingerprints+1)
+}
+
+func TestGormLoggerSampling(t *testing.T) {
+	logger := newRecordingLogger()
+	gormLogger := NewGormLogger(logger, "warn", time.Second, WithLogSampling(2, time.Hour))
+
+	queryErr := errors.New("connection refused")
+	for i := 0; i < 5; i++ {
+		sql := fmt.Sprintf("SELECT * FROM users WHERE id = %d", i)
+		gormLogger.Trace(context.Background(), time.Now(), func() (string, int64) { return sql, 0 }, queryErr)
+	}
+	gormLogger.Trace(context.Background(), time.Now(), func() (string, int64) { return "SELECT * FROM orders", 0 }, queryErr)
+
+	assert.Len(t, logger.find("SQL execution failed"), 3)
+}
+
+func TestGormLoggerSampling_RawScan(t *testing.T) {
+	logger := newRecordingLogger()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{
+		Logger: NewGormLogger(logger, "warn", time.Second, WithLogSampling(1, time.Hour)),
+	})
+	require.NoError(t, err)
+	require.NoError(t, db.Use(&statementPlugin{}))
+
+	// Distinct Scan queries are sampled in separate windows
+	var out []map[string]any
+	for i := 0; i < 3; i++ {
+		db.Raw("SELECT * FROM missing_orders WHERE id = ?", i).Scan(&out)
+		db.Raw("SELECT * FROM missing_users WHERE id = ?", i).Scan(&out)
+	}
+
+	failed := logger.find("SQL execution failed")
+	require.Len(t, failed, 2)
+	assert.NotEqual(t, failed[0].fields["fingerprint"], failed[1].fields["fingerprint"])
+}
+
+func TestGormLoggerSampling_FlushesSummaries(t *testing.T) {
+	logger := newRecordingLogger()
+	gormLogger := NewGormLogger(logger, "warn", time.Second, WithLogSampling(1, 20*time.Millisecond)).(*gormLoggerAdapter)
+	queryErr := errors.New("connection refused")
+	trace := func() {
+		gormLogger.Trace(context.Background(), time.Now(), func() (string, int64) { return "SELECT * FROM users WHERE id = 1", 0 }, queryErr)
+	}
+
+	// Summaries of ended windows are logged without waiting for another entry
+	gormLogger.startSampling()
+	trace()
+	trace()
+	require.Eventually(t, func() bool {
+		return len(logger.find("Suppressed repeated SQL error logs")) == 1
+	}, time.Second, 5*time.Millisecond)
+
+	// Pending summaries are logged on stop
+	gormLogger.stopSampling()
+	gormLogger.sampler.interval = time.Hour
+	trace()
+	trace()
+	trace()
+	gormLogger.stopSampling()
+	assert.Len(t, logger.find("Suppressed repeated SQL error logs"), 2)
+}
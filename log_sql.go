@@ -0,0 +1,420 @@
+package dbx
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gostratum/core/logx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+)
+
+// SQL logging modes
+const (
+	// LogSQLFull logs SQL with parameter values interpolated
+	LogSQLFull = "full"
+	// LogSQLPlaceholders logs SQL with placeholders and no parameter values
+	LogSQLPlaceholders = "placeholders"
+	// LogSQLParams logs SQL with placeholders and the parameter values
+	// separately, redacting values bound to sensitive columns
+	LogSQLParams = "params"
+)
+
+// redactedValue replaces redacted parameter values in logs
+const redactedValue = "[REDACTED]"
+
+// WithSQLMode sets how SQL statements are logged (full, placeholders or params)
+func WithSQLMode(mode string) GormLoggerOption {
+	return func(l *gormLoggerAdapter) {
+		if mode != "" {
+			l.sqlMode = mode
+		}
+	}
+}
+
+// WithRedactedColumns redacts parameter values bound to these columns in
+// params mode. Fields tagged `dbx:"redact"` are always redacted.
+func WithRedactedColumns(columns ...string) GormLoggerOption {
+	return func(l *gormLoggerAdapter) {
+		if l.redactColumns == nil {
+			l.redactColumns = make(map[string]bool, len(columns))
+		}
+		for _, c := range columns {
+			l.redactColumns[strings.ToLower(c)] = true
+		}
+	}
+}
+
+// ParamsFilter implements gorm's logger.ParamsFilter so that the SQL returned
+// to Trace is not interpolated unless full mode is used
+func (l *gormLoggerAdapter) ParamsFilter(ctx context.Context, sql string, params ...any) (string, []any) {
+	if l.sqlMode == LogSQLFull || l.sqlMode == "" {
+		return sql, params
+	}
+	return sql, nil
+}
+
+// sqlFields returns the sql (and params) log fields for the configured mode.
+// explained is the SQL produced by gorm, used when the statement is not
+// available on the context.
+func (l *gormLoggerAdapter) sqlFields(ctx context.Context, explained string) []logx.Field {
+	if l.sqlMode == LogSQLFull || l.sqlMode == "" {
+		return []logx.Field{logx.String("sql", explained)}
+	}
+
+	stmt := statementFromContext(ctx)
+	if stmt == nil || stmt.sql == "" {
+		return []logx.Field{logx.String("sql", explained)}
+	}
+
+	fields := []logx.Field{logx.String("sql", stmt.sql)}
+	if l.sqlMode == LogSQLParams && len(stmt.vars) > 0 {
+		fields = append(fields, logx.Any("params", l.redactParams(stmt)))
+	}
+	return fields
+}
+
+// redactParams formats the statement's parameters, redacting sensitive ones
+// and those that cannot be tied to a column
+func (l *gormLoggerAdapter) redactParams(stmt *loggedStatement) []any {
+	tagged := redactedFields(stmt.schema)
+	columns := paramColumns(stmt.sql)
+
+	params := make([]any, len(stmt.vars))
+	for i, v := range stmt.vars {
+		var column string
+		if i < len(columns) {
+			column = strings.ToLower(columns[i])
+		}
+		if column == "" || l.redactColumns[column] || tagged[column] {
+			params[i] = redactedValue
+			continue
+		}
+		params[i] = formatParam(v)
+	}
+	return params
+}
+
+// redactedFieldsCache caches the redacted columns per schema
+var redactedFieldsCache sync.Map // *schema.Schema -> map[string]bool
+
+// redactedFields returns the columns of fields tagged `dbx:"redact"`
+func redactedFields(s *schema.Schema) map[string]bool {
+	if s == nil {
+		return nil
+	}
+	if cached, ok := redactedFieldsCache.Load(s); ok {
+		return cached.(map[string]bool)
+	}
+
+	columns := make(map[string]bool)
+	for _, f := range s.Fields {
+		if f.DBName == "" {
+			continue
+		}
+		for _, opt := range strings.Split(f.Tag.Get("dbx"), ",") {
+			if strings.TrimSpace(opt) == "redact" {
+				columns[strings.ToLower(f.DBName)] = true
+			}
+		}
+	}
+
+	redactedFieldsCache.Store(s, columns)
+	return columns
+}
+
+// formatParam converts a parameter to a log-friendly value
+func formatParam(v any) any {
+	if v == nil {
+		return nil
+	}
+	if rv := reflect.ValueOf(v); rv.Kind() == reflect.Pointer && rv.IsNil() {
+		return nil
+	}
+
+	switch x := v.(type) {
+	case []byte:
+		return fmt.Sprintf("[%d bytes]", len(x))
+	case time.Time:
+		return x.Format(time.RFC3339Nano)
+	case driver.Valuer:
+		val, err := x.Value()
+		if err != nil {
+			return fmt.Sprintf("[invalid: %v]", err)
+		}
+		if _, again := val.(driver.Valuer); again {
+			return fmt.Sprint(val)
+		}
+		return formatParam(val)
+	case string, bool, int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64:
+		return x
+	default:
+		return fmt.Sprint(x)
+	}
+}
+
+// sqlKeywords are words that never name the column a placeholder binds to
+var sqlKeywords = map[string]bool{
+	"AND": true, "OR": true, "NOT": true, "IN": true, "IS": true, "NULL": true,
+	"LIKE": true, "ILIKE": true, "BETWEEN": true, "SELECT": true, "FROM": true,
+	"WHERE": true, "SET": true, "UPDATE": true, "DELETE": true, "INTO": true,
+	"AS": true, "JOIN": true, "ORDER": true, "BY": true, "GROUP": true,
+	"HAVING": true, "ASC": true, "DESC": true, "TRUE": true, "FALSE": true,
+	"CASE": true, "WHEN": true, "THEN": true, "ELSE": true, "END": true,
+	"DISTINCT": true, "EXISTS": true, "ANY": true, "ALL": true, "DO": true,
+	"CONFLICT": true, "NOTHING": true,
+}
+
+// paramColumns returns, for each placeholder in sql, the column it is bound
+// to ("" when unknown). It understands comparisons and assignments
+// (`"email" = $1`, `email IN (?,?)`) and INSERT column lists with VALUES
+// tuples, for both ? and $n placeholders. Placeholders passed to a function
+// outside a VALUES tuple, e.g. `password = crypt(?, gen_salt('bf'))`, are
+// unknown.
+func paramColumns(sql string) []string {
+	var (
+		cols      []string
+		lastIdent string
+		seq       int
+
+		// identEnd is the offset after the last unquoted identifier, so a
+		// following "(" opens a function call; calls marks the open parens
+		// that do, callDepth counts them
+		identEnd  int
+		calls     []bool
+		callDepth int
+
+		insertPending bool
+		inInsertCols  bool
+		insertCols    []string
+		inValues      bool
+		tupleIdx      int
+		depth         int
+	)
+
+	assign := func(idx int) {
+		for len(cols) <= idx {
+			cols = append(cols, "")
+		}
+		if inValues && depth >= 1 {
+			if tupleIdx < len(insertCols) {
+				cols[idx] = insertCols[tupleIdx]
+			}
+			return
+		}
+		if callDepth > 0 {
+			return
+		}
+		cols[idx] = lastIdent
+	}
+
+	ident := func(name string, quoted bool) {
+		if inInsertCols {
+			insertCols = append(insertCols, name)
+			return
+		}
+		if !quoted {
+			switch upper := strings.ToUpper(name); upper {
+			case "INSERT":
+				insertPending = true
+				return
+			case "VALUES":
+				inValues = true
+				return
+			case "ON", "RETURNING":
+				inValues = false
+				return
+			case "LIMIT", "OFFSET":
+				lastIdent = ""
+				return
+			default:
+				if sqlKeywords[upper] {
+					return
+				}
+			}
+		}
+		lastIdent = name
+	}
+
+	for i := 0; i < len(sql); i++ {
+		c := sql[i]
+		switch {
+		case c == '\'':
+			// Skip string literals, including '' escapes
+			for i++; i < len(sql); i++ {
+				if sql[i] == '\'' {
+					if i+1 < len(sql) && sql[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+		case c == '"' || c == '`':
+			end := strings.IndexByte(sql[i+1:], c)
+			if end < 0 {
+				return cols
+			}
+			ident(sql[i+1:i+1+end], true)
+			i += end + 1
+		case c == '_' || (c|0x20 >= 'a' && c|0x20 <= 'z'):
+			j := i + 1
+			for j < len(sql) && (sql[j] == '_' || (sql[j]|0x20 >= 'a' && sql[j]|0x20 <= 'z') || (sql[j] >= '0' && sql[j] <= '9')) {
+				j++
+			}
+			ident(sql[i:j], false)
+			if !sqlKeywords[strings.ToUpper(sql[i:j])] {
+				identEnd = j
+			}
+			i = j - 1
+		case c == '?':
+			assign(seq)
+			seq++
+		case c == '$' && i+1 < len(sql) && sql[i+1] >= '0' && sql[i+1] <= '9':
+			j := i + 1
+			for j < len(sql) && sql[j] >= '0' && sql[j] <= '9' {
+				j++
+			}
+			if n, err := strconv.Atoi(sql[i+1 : j]); err == nil && n > 0 {
+				assign(n - 1)
+			}
+			i = j - 1
+		case c == '(':
+			call := false
+			switch {
+			case depth == 0 && insertPending:
+				insertPending = false
+				inInsertCols = true
+			case identEnd > 0 && strings.TrimSpace(sql[identEnd:i]) == "":
+				call = true
+				callDepth++
+			}
+			calls = append(calls, call)
+			if depth == 0 && inValues {
+				tupleIdx = 0
+			}
+			depth++
+		case c == ')':
+			if n := len(calls); n > 0 {
+				if calls[n-1] {
+					callDepth--
+				}
+				calls = calls[:n-1]
+			}
+			depth--
+			if depth == 0 {
+				inInsertCols = false
+			}
+		case c == ',':
+			if inValues && depth == 1 {
+				tupleIdx++
+			}
+		}
+	}
+
+	return cols
+}
+
+// statementKey is the context key under which the current statement is stored
+type statementKey struct{}
+
+// loggedStatement is stored on a statement's context for the logger. The SQL
+// and parameters are copied once the callbacks have run, because gorm resets
+// the statement before calling Trace on some paths, e.g. Raw().Scan().
+type loggedStatement struct {
+	stmt   *gorm.Statement
+	schema *schema.Schema
+	sql    string
+	vars   []any
+}
+
+// statementFromContext returns the statement stored by the statement plugin
+func statementFromContext(ctx context.Context) *loggedStatement {
+	if ctx == nil {
+		return nil
+	}
+	stmt, _ := ctx.Value(statementKey{}).(*loggedStatement)
+	return stmt
+}
+
+const statementPluginName = "dbx:log_statement"
+
+// statementPlugin stores each statement on its own context so the logger can
+// log SQL with placeholders and its parameters separately
+type statementPlugin struct{}
+
+// Name returns the plugin name
+func (p *statementPlugin) Name() string {
+	return statementPluginName
+}
+
+// Initialize registers the callbacks
+func (p *statementPlugin) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Create().Before("*").Register(statementPluginName, storeStatement); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("*").Register(statementPluginName, storeStatement); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("*").Register(statementPluginName, storeStatement); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("*").Register(statementPluginName, storeStatement); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("*").Register(statementPluginName, storeStatement); err != nil {
+		return err
+	}
+	if err := cb.Raw().Before("*").Register(statementPluginName, storeStatement); err != nil {
+		return err
+	}
+
+	// Copy the SQL once it is built; see loggedStatement
+	capture := statementPluginName + ":capture"
+	if err := cb.Create().After("*").Register(capture, captureStatement); err != nil {
+		return err
+	}
+	if err := cb.Query().After("*").Register(capture, captureStatement); err != nil {
+		return err
+	}
+	if err := cb.Update().After("*").Register(capture, captureStatement); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("*").Register(capture, captureStatement); err != nil {
+		return err
+	}
+	if err := cb.Row().After("*").Register(capture, captureStatement); err != nil {
+		return err
+	}
+	return cb.Raw().After("*").Register(capture, captureStatement)
+}
+
+// storeStatement puts the statement on its context, once per statement
+func storeStatement(db *gorm.DB) {
+	ctx := db.Statement.Context
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if stmt := statementFromContext(ctx); stmt != nil && stmt.stmt == db.Statement {
+		return
+	}
+	db.Statement.Context = context.WithValue(ctx, statementKey{}, &loggedStatement{stmt: db.Statement})
+}
+
+// captureStatement copies the SQL and parameters the statement ran with
+func captureStatement(db *gorm.DB) {
+	stmt := statementFromContext(db.Statement.Context)
+	if stmt == nil || stmt.stmt != db.Statement {
+		return
+	}
+	stmt.schema = db.Statement.Schema
+	stmt.sql = db.Statement.SQL.String()
+	stmt.vars = append(stmt.vars[:0], db.Statement.Vars...)
+}
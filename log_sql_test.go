@@ -0,0 +1,146 @@
+package dbx
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestParamColumns(t *testing.T) {
+	tests := []struct {
+		name string
+		sql  string
+		want []string
+	}{
+		{
+			name: "postgres comparisons",
+			sql:  `SELECT * FROM "users" WHERE "email" = $1 AND age > $2`,
+			want: []string{"email", "age"},
+		},
+		{
+			name: "sqlite placeholders",
+			sql:  "SELECT * FROM `users` WHERE `users`.`password` = ? AND id = ?",
+			want: []string{"password", "id"},
+		},
+		{
+			name: "insert tuples",
+			sql:  `INSERT INTO "users" ("name","password") VALUES ($1,$2),($3,$4) RETURNING "id"`,
+			want: []string{"name", "password", "name", "password"},
+		},
+		{
+			name: "in list",
+			sql:  `SELECT * FROM users WHERE token IN (?,?) LIMIT ?`,
+			want: []string{"token", "token", ""},
+		},
+		{
+			name: "update assignments",
+			sql:  `UPDATE "users" SET "password"=$1,"updated_at"=$2 WHERE "id" = $3`,
+			want: []string{"password", "updated_at", "id"},
+		},
+		{
+			name: "string literals are skipped",
+			sql:  `SELECT * FROM users WHERE note = 'a ? b ''c''' AND secret = ?`,
+			want: []string{"secret"},
+		},
+		{
+			name: "function arguments are unknown",
+			sql:  `UPDATE users SET password = crypt(?, gen_salt('bf')) WHERE lower(email) = ?`,
+			want: []string{"", "email"},
+		},
+		{
+			name: "nested function arguments are unknown",
+			sql:  `SELECT * FROM users WHERE token = coalesce(nullif($1, ''), $2) AND id = $3`,
+			want: []string{"", "", "id"},
+		},
+		{
+			name: "function arguments in values tuples",
+			sql:  `INSERT INTO users (name,password) VALUES (?,crypt(?, gen_salt('bf')))`,
+			want: []string{"name", "password"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.want, paramColumns(tt.sql))
+		})
+	}
+}
+
+type redactedUser struct {
+	ID       uint
+	Email    string
+	Password string `dbx:"redact"`
+	Token    string
+}
+
+func setupLoggedDB(t *testing.T, mode string, columns ...string) (*gorm.DB, *recordingLogger) {
+	logger := newRecordingLogger()
+	gormLogger := NewGormLogger(logger, "info", time.Second,
+		WithSQLMode(mode), WithRedactedColumns(columns...))
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormLogger})
+	require.NoError(t, err)
+	require.NoError(t, db.Use(&statementPlugin{}))
+	require.NoError(t, db.AutoMigrate(&redactedUser{}))
+	return db, logger
+}
+
+func TestGormLoggerSQLParams(t *testing.T) {
+	db, logger := setupLoggedDB(t, LogSQLParams, "token")
+
+	require.NoError(t, db.Create(&redactedUser{Email: "a@example.com", Password: "hunter2", Token: "t0k"}).Error)
+
+	var entry *logEntry
+	for _, e := range logger.find("SQL query executed") {
+		if sql, _ := e.fields["sql"].(string); len(sql) > 6 && sql[:6] == "INSERT" {
+			entry = &e
+		}
+	}
+	require.NotNil(t, entry)
+
+	assert.NotContains(t, entry.fields["sql"], "hunter2")
+	assert.Contains(t, entry.fields["sql"], "?")
+	assert.Equal(t, []any{"a@example.com", redactedValue, redactedValue}, entry.fields["params"])
+}
+
+func TestGormLoggerSQLParams_RawScan(t *testing.T) {
+	db, logger := setupLoggedDB(t, LogSQLParams, "token")
+
+	var users []redactedUser
+	require.NoError(t, db.Raw("SELECT * FROM redacted_users WHERE email = ? AND token = ?", "a@example.com", "t0k").Scan(&users).Error)
+
+	entries := logger.find("SQL query executed")
+	require.NotEmpty(t, entries)
+	last := entries[len(entries)-1]
+	assert.Equal(t, "SELECT * FROM redacted_users WHERE email = ? AND token = ?", last.fields["sql"])
+	assert.Equal(t, []any{"a@example.com", redactedValue}, last.fields["params"])
+}
+
+func TestGormLoggerSQLParams_FunctionArguments(t *testing.T) {
+	db, logger := setupLoggedDB(t, LogSQLParams)
+
+	require.NoError(t, db.Exec("UPDATE redacted_users SET password = replace(?, 'x', 'y') WHERE id = ?", "hunter2", 1).Error)
+
+	entries := logger.find("SQL query executed")
+	require.NotEmpty(t, entries)
+	last := entries[len(entries)-1]
+	assert.Equal(t, []any{redactedValue, 1}, last.fields["params"])
+}
+
+func TestGormLoggerSQLPlaceholders(t *testing.T) {
+	db, logger := setupLoggedDB(t, LogSQLPlaceholders)
+
+	var user redactedUser
+	_ = db.Where("email = ?", "a@example.com").First(&user).Error
+
+	entries := logger.find("SQL query executed")
+	require.NotEmpty(t, entries)
+	last := entries[len(entries)-1]
+	assert.Contains(t, last.fields["sql"], "email = ?")
+	assert.NotContains(t, last.fields["sql"], "a@example.com")
+	assert.NotContains(t, last.fields, "params")
+}
@@ -7,121 +7,185 @@ import (
 	"time"
 
 	"github.com/gostratum/core/logx"
+	"go.opentelemetry.io/otel/trace"
 	"gorm.io/gorm"
 	gormlogger "gorm.io/gorm/logger"
 )
 
+// ContextFieldExtractor derives log fields from a request context
+type ContextFieldExtractor func(ctx context.Context) []logx.Field
+
+// GormLoggerOption configures the GORM logger
+type GormLoggerOption func(*gormLoggerAdapter)
+
+// WithContextFields adds extractors whose fields are attached to every SQL log.
+// The OpenTelemetry trace extractor is always included.
+func WithContextFields(extractors ...ContextFieldExtractor) GormLoggerOption {
+	return func(l *gormLoggerAdapter) {
+		l.extractors = append(l.extractors, extractors...)
+	}
+}
+
+// WithDatabaseName tags every SQL log with the connection name
+func WithDatabaseName(name string) GormLoggerOption {
+	return func(l *gormLoggerAdapter) {
+		if name != "" {
+			l.logger = l.logger.With(logx.String("database", name))
+		}
+	}
+}
+
+// ContextValueField logs ctx.Value(key) under name. Use it with the typed
+// context keys of your middleware; values are formatted with fmt.Sprint
+// unless they are strings.
+func ContextValueField(name string, key any) ContextFieldExtractor {
+	return func(ctx context.Context) []logx.Field {
+		v := ctx.Value(key)
+		if v == nil {
+			return nil
+		}
+		if str, ok := v.(string); ok {
+			return []logx.Field{logx.String(name, str)}
+		}
+		return []logx.Field{logx.String(name, fmt.Sprint(v))}
+	}
+}
+
+// TraceContextFields extracts the OpenTelemetry trace_id and span_id
+func TraceContextFields(ctx context.Context) []logx.Field {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.IsValid() {
+		return nil
+	}
+	return []logx.Field{
+		logx.String("trace_id", sc.TraceID().String()),
+		logx.String("span_id", sc.SpanID().String()),
+	}
+}
+
 type gormLoggerAdapter struct {
 	logger        logx.Logger
-	logLevel      gormlogger.LogLevel
-	slowThreshold time.Duration
+	settings      *logSettings
+	modeLevel     gormlogger.LogLevel
+	extractors    []ContextFieldExtractor
+	sqlMode       string
+	redactColumns map[string]bool
+	sampler       *logSampler
+	explainer     *queryExplainer
 }
 
 // NewGormLogger creates a new GORM logger using zap
-func NewGormLogger(logger logx.Logger, logLevel string, slowThreshold time.Duration) gormlogger.Interface {
-	var level gormlogger.LogLevel
-
-	switch logLevel {
-	case "silent":
-		level = gormlogger.Silent
-	case "error":
-		level = gormlogger.Error
-	case "warn":
-		level = gormlogger.Warn
-	case "info":
-		level = gormlogger.Info
-	default:
+func NewGormLogger(logger logx.Logger, logLevel string, slowThreshold time.Duration, opts ...GormLoggerOption) gormlogger.Interface {
+	level, ok := parseLogLevel(logLevel)
+	if !ok {
 		level = gormlogger.Warn
 	}
 
 	// approximate zap.Named by adding a component field via With
-	return &gormLoggerAdapter{
-		logger:        logger.With(logx.String("component", "gorm")),
-		logLevel:      level,
-		slowThreshold: slowThreshold,
+	l := &gormLoggerAdapter{
+		logger:     logger.With(logx.String("component", "gorm")),
+		extractors: []ContextFieldExtractor{TraceContextFields},
+		sqlMode:    LogSQLFull,
+	}
+	for _, opt := range opts {
+		opt(l)
 	}
+	l.settings = newLogSettings(level, slowThreshold, l.logger)
+	return l
 }
 
 // LogMode sets the log level
 func (l *gormLoggerAdapter) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
 	newLogger := *l
-	newLogger.logLevel = level
+	newLogger.modeLevel = level
 	return &newLogger
 }
 
+// level returns the level set with LogMode, or the current runtime level
+func (l *gormLoggerAdapter) level() gormlogger.LogLevel {
+	if l.modeLevel != 0 {
+		return l.modeLevel
+	}
+	return l.settings.level()
+}
+
 // Info logs info level messages
 func (l *gormLoggerAdapter) Info(ctx context.Context, msg string, data ...any) {
-	if l.logLevel >= gormlogger.Info {
+	if l.level() >= gormlogger.Info {
 		l.logger.Info(fmt.Sprintf(msg, data...), l.contextFields(ctx)...)
 	}
 }
 
 // Warn logs warn level messages
 func (l *gormLoggerAdapter) Warn(ctx context.Context, msg string, data ...any) {
-	if l.logLevel >= gormlogger.Warn {
+	if l.level() >= gormlogger.Warn {
 		l.logger.Warn(fmt.Sprintf(msg, data...), l.contextFields(ctx)...)
 	}
 }
 
 // Error logs error level messages
 func (l *gormLoggerAdapter) Error(ctx context.Context, msg string, data ...any) {
-	if l.logLevel >= gormlogger.Error {
+	if l.level() >= gormlogger.Error {
 		l.logger.Error(fmt.Sprintf(msg, data...), l.contextFields(ctx)...)
 	}
 }
 
 // Trace logs SQL traces
 func (l *gormLoggerAdapter) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
-	if l.logLevel <= gormlogger.Silent {
+	level := l.level()
+	if level <= gormlogger.Silent {
 		return
 	}
 
 	elapsed := time.Since(begin)
+	slowThreshold := l.settings.slowThreshold()
 	sql, rows := fc()
 
-	fields := []logx.Field{
-		logx.Duration("elapsed", elapsed),
-		logx.String("sql", sql),
-		logx.Int64("rows", rows),
-	}
-	fields = append(fields, l.contextFields(ctx)...)
-
 	switch {
-	case err != nil && l.logLevel >= gormlogger.Error && (!errors.Is(err, gorm.ErrRecordNotFound)):
-		fields = append(fields, logx.Err(err))
+	case err != nil && level >= gormlogger.Error && (!errors.Is(err, gorm.ErrRecordNotFound)):
+		shape, fingerprint := Fingerprint(l.statementSQL(ctx, sql))
+		if !l.sampled("error", shape, fingerprint) {
+			return
+		}
+		fields := l.traceFields(ctx, elapsed, sql, rows, fingerprint)
+		fields = append(fields, logx.Err(err), logx.String("query_caller", callerLocation()))
 		l.logger.Error("SQL execution failed", fields...)
-	case elapsed > l.slowThreshold && l.slowThreshold != 0 && l.logLevel >= gormlogger.Warn:
-		fields = append(fields, logx.Duration("slow_threshold", l.slowThreshold))
+	case elapsed > slowThreshold && slowThreshold != 0 && level >= gormlogger.Warn:
+		shape, fingerprint := Fingerprint(l.statementSQL(ctx, sql))
+		if l.explainer != nil {
+			if stmt := statementFromContext(ctx); stmt != nil {
+				l.explainer.capture(stmt.sql, stmt.vars, fingerprint, elapsed)
+			}
+		}
+		if !l.sampled("warn", shape, fingerprint) {
+			return
+		}
+		fields := l.traceFields(ctx, elapsed, sql, rows, fingerprint)
+		fields = append(fields, logx.Duration("slow_threshold", slowThreshold), logx.String("query_caller", callerLocation()))
 		l.logger.Warn("Slow SQL query detected", fields...)
-	case l.logLevel == gormlogger.Info:
-		l.logger.Info("SQL query executed", fields...)
+	case level == gormlogger.Info:
+		_, fingerprint := Fingerprint(l.statementSQL(ctx, sql))
+		l.logger.Info("SQL query executed", l.traceFields(ctx, elapsed, sql, rows, fingerprint)...)
 	}
 }
 
+// traceFields returns the fields shared by all SQL trace logs
+func (l *gormLoggerAdapter) traceFields(ctx context.Context, elapsed time.Duration, sql string, rows int64, fingerprint string) []logx.Field {
+	fields := []logx.Field{logx.Duration("elapsed", elapsed)}
+	fields = append(fields, l.sqlFields(ctx, sql)...)
+	fields = append(fields, logx.Int64("rows", rows), logx.String("fingerprint", fingerprint))
+	return append(fields, l.contextFields(ctx)...)
+}
+
 // contextFields extracts logging fields from context
 func (l *gormLoggerAdapter) contextFields(ctx context.Context) []logx.Field {
-	var fields []logx.Field
-
-	// Extract trace ID if available
-	if traceID := ctx.Value("trace_id"); traceID != nil {
-		if id, ok := traceID.(string); ok {
-			fields = append(fields, logx.String("trace_id", id))
-		}
+	if ctx == nil {
+		return nil
 	}
 
-	// Extract request ID if available
-	if requestID := ctx.Value("request_id"); requestID != nil {
-		if id, ok := requestID.(string); ok {
-			fields = append(fields, logx.String("request_id", id))
-		}
-	}
-
-	// Extract user ID if available
-	if userID := ctx.Value("user_id"); userID != nil {
-		if id, ok := userID.(string); ok {
-			fields = append(fields, logx.String("user_id", id))
-		}
+	var fields []logx.Field
+	for _, extract := range l.extractors {
+		fields = append(fields, extract(ctx)...)
 	}
-
 	return fields
 }
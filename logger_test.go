@@ -0,0 +1,90 @@
+package dbx
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+type requestIDKey struct{}
+
+type tenantID int
+
+type tenantKey struct{}
+
+func TestGormLoggerContextFields(t *testing.T) {
+	traceID, err := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	require.NoError(t, err)
+	spanID, err := trace.SpanIDFromHex("00f067aa0ba902b7")
+	require.NoError(t, err)
+
+	ctx := trace.ContextWithSpanContext(context.Background(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    traceID,
+		SpanID:     spanID,
+		TraceFlags: trace.FlagsSampled,
+	}))
+	ctx = context.WithValue(ctx, requestIDKey{}, "req-123")
+	ctx = context.WithValue(ctx, tenantKey{}, tenantID(42))
+
+	logger := newRecordingLogger()
+	gormLogger := NewGormLogger(logger, "info", time.Second, WithContextFields(
+		ContextValueField("request_id", requestIDKey{}),
+		ContextValueField("tenant_id", tenantKey{}),
+	))
+
+	gormLogger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT 1", 1 }, nil)
+
+	entries := logger.find("SQL query executed")
+	require.Len(t, entries, 1)
+	fields := entries[0].fields
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", fields["trace_id"])
+	assert.Equal(t, "00f067aa0ba902b7", fields["span_id"])
+	assert.Equal(t, "req-123", fields["request_id"])
+	assert.Equal(t, "42", fields["tenant_id"])
+}
+
+func TestGormLoggerContextFields_Absent(t *testing.T) {
+	logger := newRecordingLogger()
+	gormLogger := NewGormLogger(logger, "info", time.Second, WithContextFields(
+		ContextValueField("request_id", requestIDKey{}),
+	))
+
+	// Raw string keys are not looked up
+	//nolint:staticcheck // verifying that untyped keys are ignored
+	ctx := context.WithValue(context.Background(), "request_id", "ignored")
+	gormLogger.Trace(ctx, time.Now(), func() (string, int64) { return "SELECT 1", 1 }, nil)
+
+	entries := logger.find("SQL query executed")
+	require.Len(t, entries, 1)
+	assert.NotContains(t, entries[0].fields, "trace_id")
+	assert.NotContains(t, entries[0].fields, "request_id")
+}
+
+func TestGormLoggerDatabaseAndCaller(t *testing.T) {
+	logger := newRecordingLogger()
+	gormLogger := NewGormLogger(logger, "warn", time.Nanosecond, WithDatabaseName("analytics"))
+
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: gormLogger})
+	require.NoError(t, err)
+	require.NoError(t, db.Exec("SELECT 1").Error)
+
+	entries := logger.find("Slow SQL query detected")
+	require.NotEmpty(t, entries)
+	fields := entries[len(entries)-1].fields
+	assert.Equal(t, "analytics", fields["database"])
+	assert.NotEmpty(t, fields["query_caller"])
+	_, fingerprint := Fingerprint("SELECT 1")
+	assert.Equal(t, fingerprint, fields["fingerprint"])
+
+	assert.Error(t, db.Exec("SELECT * FROM missing").Error)
+	entries = logger.find("SQL execution failed")
+	require.Len(t, entries, 1)
+	assert.Equal(t, "analytics", entries[0].fields["database"])
+	assert.NotEmpty(t, entries[0].fields["query_caller"])
+}
@@ -1,7 +1,9 @@
 package dbx
 
 import (
-	"context"
+	"errors"
+	"slices"
+	"sync"
 	"time"
 
 	"github.com/gostratum/metricsx"
@@ -15,7 +17,8 @@ const (
 
 // MetricsPlugin implements GORM plugin interface for metrics collection
 type MetricsPlugin struct {
-	metrics metricsx.Metrics
+	metrics  metricsx.Metrics
+	database string
 
 	// Metric collectors
 	queryCounter  metricsx.Counter
@@ -23,32 +26,139 @@ type MetricsPlugin struct {
 	queryErrors   metricsx.Counter
 	activeQueries metricsx.Gauge
 	rowsAffected  metricsx.Histogram
+
+	// Collector settings
+	namespace       string
+	subsystem       string
+	durationBuckets []float64
+	rowsBuckets     []float64
+	// txDurationBuckets are used by the transaction metrics, not the plugin
+	txDurationBuckets []float64
+
+	// tables bounds the table label, nil when it is unbounded
+	tables     *cappedLabels
+	tableLabel bool
+	// fingerprints bounds the fingerprint label, nil when it is disabled
+	fingerprints *cappedLabels
+
+	// Query event subscribers
+	subscriptions []*querySubscription
+	eventFields   []ContextFieldExtractor
+	events        queryEvents
+}
+
+// MetricsOption configures a MetricsPlugin
+type MetricsOption func(*MetricsPlugin)
+
+// WithMetricsDatabase sets the database label of the plugin's metrics
+// ("default" when unset). The module sets it to the connection name.
+func WithMetricsDatabase(name string) MetricsOption {
+	return func(p *MetricsPlugin) {
+		p.database = name
+	}
+}
+
+// WithFingerprintLabel adds a fingerprint label (see Fingerprint) to
+// db_queries_total and db_query_duration_seconds. Only the first limit
+// distinct fingerprints get their own label value; later ones are "other".
+func WithFingerprintLabel(limit int) MetricsOption {
+	return func(p *MetricsPlugin) {
+		if limit > 0 {
+			p.fingerprints = newCappedLabels(limit)
+		}
+	}
+}
+
+// WithMetricsNamespace prefixes every dbx metric name with namespace, e.g.
+// myapp_db_queries_total, overriding the namespace of the metricsx provider
+func WithMetricsNamespace(namespace string) MetricsOption {
+	return func(p *MetricsPlugin) {
+		p.namespace = namespace
+	}
+}
+
+// WithMetricsSubsystem adds subsystem between the namespace and the name of
+// every dbx metric
+func WithMetricsSubsystem(subsystem string) MetricsOption {
+	return func(p *MetricsPlugin) {
+		p.subsystem = subsystem
+	}
+}
+
+// WithDurationBuckets sets the buckets, in seconds, of db_query_duration_seconds
+func WithDurationBuckets(buckets ...float64) MetricsOption {
+	return func(p *MetricsPlugin) {
+		p.durationBuckets = buckets
+	}
+}
+
+// WithRowsBuckets sets the buckets of db_rows_affected
+func WithRowsBuckets(buckets ...float64) MetricsOption {
+	return func(p *MetricsPlugin) {
+		p.rowsBuckets = buckets
+	}
+}
+
+// WithTransactionDurationBuckets sets the buckets, in seconds, of
+// db_transaction_duration_seconds
+func WithTransactionDurationBuckets(buckets ...float64) MetricsOption {
+	return func(p *MetricsPlugin) {
+		p.txDurationBuckets = buckets
+	}
+}
+
+// WithoutTableLabel drops the table label from query metrics
+func WithoutTableLabel() MetricsOption {
+	return func(p *MetricsPlugin) {
+		p.tableLabel = false
+	}
+}
+
+// WithTableLabelLimit caps the table label: only the first limit distinct
+// tables get their own label value; later ones are "other"
+func WithTableLabelLimit(limit int) MetricsOption {
+	return func(p *MetricsPlugin) {
+		if limit > 0 {
+			p.tables = newCappedLabels(limit)
+		}
+	}
 }
 
 // NewMetricsPlugin creates a new metrics plugin for GORM
-func NewMetricsPlugin(metrics metricsx.Metrics) *MetricsPlugin {
-	plugin := &MetricsPlugin{
-		metrics: metrics,
+func NewMetricsPlugin(metrics metricsx.Metrics, opts ...MetricsOption) *MetricsPlugin {
+	plugin := newMetricsPlugin(opts...)
+	plugin.metrics = plugin.scoped(metrics)
+	metrics = plugin.metrics
+
+	labels := []string{"database", "role"}
+	if plugin.tableLabel {
+		labels = append(labels, "table")
+	}
+	labels = append(labels, "operation")
+
+	queryLabels := labels
+	if plugin.fingerprints != nil {
+		queryLabels = append(slices.Clip(labels), "fingerprint")
 	}
 
 	// Initialize metric collectors
 	plugin.queryCounter = metrics.Counter(
 		"db_queries_total",
 		metricsx.WithHelp("Total number of database queries"),
-		metricsx.WithLabels("database", "table", "operation"),
+		metricsx.WithLabels(queryLabels...),
 	)
 
 	plugin.queryDuration = metrics.Histogram(
 		"db_query_duration_seconds",
 		metricsx.WithHelp("Database query duration in seconds"),
-		metricsx.WithLabels("database", "table", "operation"),
-		metricsx.WithBuckets(0.0001, 0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0),
+		metricsx.WithLabels(queryLabels...),
+		metricsx.WithBuckets(plugin.durationBuckets...),
 	)
 
 	plugin.queryErrors = metrics.Counter(
 		"db_query_errors_total",
 		metricsx.WithHelp("Total number of database query errors"),
-		metricsx.WithLabels("database", "table", "operation", "error_type"),
+		metricsx.WithLabels(append(slices.Clip(labels), "error_type")...),
 	)
 
 	plugin.activeQueries = metrics.Gauge(
@@ -60,13 +170,70 @@ func NewMetricsPlugin(metrics metricsx.Metrics) *MetricsPlugin {
 	plugin.rowsAffected = metrics.Histogram(
 		"db_rows_affected",
 		metricsx.WithHelp("Number of rows affected by database operations"),
-		metricsx.WithLabels("database", "table", "operation"),
-		metricsx.WithBuckets(1, 10, 50, 100, 500, 1000, 5000, 10000),
+		metricsx.WithLabels(labels...),
+		metricsx.WithBuckets(plugin.rowsBuckets...),
 	)
 
+	if len(plugin.subscriptions) > 0 {
+		plugin.startSubscriptions()
+	}
+
 	return plugin
 }
 
+// newMetricsPlugin applies the options to the default settings
+func newMetricsPlugin(opts ...MetricsOption) *MetricsPlugin {
+	p := &MetricsPlugin{
+		database:          "default",
+		durationBuckets:   []float64{0.0001, 0.0005, 0.001, 0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0},
+		rowsBuckets:       []float64{1, 10, 50, 100, 500, 1000, 5000, 10000},
+		txDurationBuckets: []float64{0.001, 0.005, 0.01, 0.05, 0.1, 0.25, 0.5, 1.0, 2.5, 5.0, 10.0, 30.0, 60.0},
+		tableLabel:        true,
+		eventFields:       []ContextFieldExtractor{TraceContextFields},
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	return p
+}
+
+// scoped applies the namespace and subsystem to collectors registered with metrics
+func (p *MetricsPlugin) scoped(metrics metricsx.Metrics) metricsx.Metrics {
+	if metrics == nil || (p.namespace == "" && p.subsystem == "") {
+		return metrics
+	}
+	var opts []metricsx.Option
+	if p.namespace != "" {
+		opts = append(opts, metricsx.WithNamespace(p.namespace))
+	}
+	if p.subsystem != "" {
+		opts = append(opts, metricsx.WithSubsystem(p.subsystem))
+	}
+	return scopedMetrics{Metrics: metrics, opts: opts}
+}
+
+// scopedMetrics adds options to every collector it registers
+type scopedMetrics struct {
+	metricsx.Metrics
+	opts []metricsx.Option
+}
+
+func (m scopedMetrics) Counter(name string, opts ...metricsx.Option) metricsx.Counter {
+	return m.Metrics.Counter(name, append(opts, m.opts...)...)
+}
+
+func (m scopedMetrics) Gauge(name string, opts ...metricsx.Option) metricsx.Gauge {
+	return m.Metrics.Gauge(name, append(opts, m.opts...)...)
+}
+
+func (m scopedMetrics) Histogram(name string, opts ...metricsx.Option) metricsx.Histogram {
+	return m.Metrics.Histogram(name, append(opts, m.opts...)...)
+}
+
+func (m scopedMetrics) Summary(name string, opts ...metricsx.Option) metricsx.Summary {
+	return m.Metrics.Summary(name, append(opts, m.opts...)...)
+}
+
 // Name returns the plugin name
 func (p *MetricsPlugin) Name() string {
 	return metricsPluginName
@@ -84,11 +251,7 @@ func (p *MetricsPlugin) Initialize(db *gorm.DB) error {
 
 // registerCallbacks registers GORM callbacks for metrics collection
 func (p *MetricsPlugin) registerCallbacks(db *gorm.DB) error {
-	// Get database name from config if available
-	dbName := "default"
-	if dbConfig, ok := db.Config.ConnPool.(interface{ Name() string }); ok {
-		dbName = dbConfig.Name()
-	}
+	dbName := p.database
 
 	// Register Create callbacks
 	if err := db.Callback().Create().Before("gorm:create").Register(metricsPluginName+":before", p.before(dbName)); err != nil {
@@ -158,6 +321,9 @@ func (p *MetricsPlugin) after(dbName, operation string) func(*gorm.DB) {
 		// Decrement active queries
 		p.activeQueries.Dec(dbName)
 
+		// Primary or read replica, resolved by dbresolver before the query ran
+		role := connectionRole(db)
+
 		// Get table name
 		tableName := db.Statement.Table
 		if tableName == "" {
@@ -165,38 +331,97 @@ func (p *MetricsPlugin) after(dbName, operation string) func(*gorm.DB) {
 		}
 
 		// Calculate duration
-		var duration float64
+		var start time.Time
+		var elapsed time.Duration
 		if startTime, ok := db.InstanceGet(startTimeKey); ok {
 			if t, ok := startTime.(time.Time); ok {
-				duration = time.Since(t).Seconds()
+				start = t
+				elapsed = time.Since(t)
 			}
 		}
 
+		var normalized, fingerprint string
+		if p.fingerprints != nil || len(p.subscriptions) > 0 {
+			normalized, fingerprint = Fingerprint(db.Statement.SQL.String())
+		}
+
 		// Record metrics
-		p.queryCounter.Inc(dbName, tableName, operation)
-		p.queryDuration.Observe(duration, dbName, tableName, operation)
+		labels := []string{dbName, role}
+		if p.tableLabel {
+			tableLabel := tableName
+			if p.tables != nil {
+				tableLabel = p.tables.label(tableName)
+			}
+			labels = append(labels, tableLabel)
+		}
+		labels = append(labels, operation)
+
+		queryLabels := labels
+		if p.fingerprints != nil {
+			queryLabels = append(slices.Clip(labels), p.fingerprints.label(fingerprint))
+		}
+		p.queryCounter.Inc(queryLabels...)
+		p.queryDuration.Observe(elapsed.Seconds(), queryLabels...)
 
 		// Record rows affected if available
 		if db.RowsAffected > 0 {
-			p.rowsAffected.Observe(float64(db.RowsAffected), dbName, tableName, operation)
+			p.rowsAffected.Observe(float64(db.RowsAffected), labels...)
 		}
 
 		// Record errors
-		if db.Error != nil && db.Error != gorm.ErrRecordNotFound {
-			errorType := "unknown"
-			switch db.Error {
-			case context.Canceled:
-				errorType = "canceled"
-			case context.DeadlineExceeded:
-				errorType = "timeout"
-			default:
-				errorType = "query_error"
-			}
-			p.queryErrors.Inc(dbName, tableName, operation, errorType)
+		var errorType string
+		if db.Error != nil && !errors.Is(db.Error, gorm.ErrRecordNotFound) {
+			errorType = ClassifyError(db.Error)
+			p.queryErrors.Inc(append(slices.Clip(labels), errorType)...)
+		}
+
+		if len(p.subscriptions) > 0 {
+			p.publish(QueryEvent{
+				Database:     dbName,
+				Role:         role,
+				Table:        tableName,
+				Operation:    operation,
+				Fingerprint:  fingerprint,
+				SQL:          normalized,
+				Start:        start,
+				Duration:     elapsed,
+				RowsAffected: db.RowsAffected,
+				Err:          db.Error,
+				ErrorType:    errorType,
+				Fields:       p.eventContextFields(db.Statement.Context),
+			})
 		}
 	}
 }
 
+// overflowLabel is the label value shared by values past a cappedLabels limit
+const overflowLabel = "other"
+
+// cappedLabels hands out label values up to a limit
+type cappedLabels struct {
+	mu    sync.Mutex
+	limit int
+	seen  map[string]struct{}
+}
+
+func newCappedLabels(limit int) *cappedLabels {
+	return &cappedLabels{limit: limit, seen: make(map[string]struct{})}
+}
+
+// label returns value, or "other" once the limit has been reached
+func (c *cappedLabels) label(value string) string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.seen[value]; ok {
+		return value
+	}
+	if len(c.seen) >= c.limit {
+		return overflowLabel
+	}
+	c.seen[value] = struct{}{}
+	return value
+}
+
 // ConnectionPoolMetricsWithContext adds connection pool metrics with context for cleanup
 func ConnectionPoolMetricsWithContext(metrics metricsx.Metrics, db *gorm.DB, dbName string, stopChan <-chan struct{}) {
 	// Create connection pool metrics
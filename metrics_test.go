@@ -0,0 +1,80 @@
+package dbx
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+)
+
+func TestMetricsPluginDatabaseAndRole(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.Exec("CREATE TABLE test_users (id INTEGER PRIMARY KEY, name TEXT)").Error)
+
+	// A separate in-memory database stands in for the read replica
+	replica, err := sql.Open("sqlite3", ":memory:")
+	require.NoError(t, err)
+	replica.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = replica.Close() })
+	_, err = replica.Exec("CREATE TABLE test_users (id INTEGER PRIMARY KEY, name TEXT)")
+	require.NoError(t, err)
+	require.NoError(t, db.Use(dbresolver.Register(dbresolver.Config{
+		Replicas: []gorm.Dialector{sqlite.New(sqlite.Config{Conn: replica})},
+	})))
+	require.NoError(t, db.Use(&replicaSet{pools: []*sql.DB{replica}}))
+
+	metrics := newMockMetrics()
+	require.NoError(t, db.Use(NewMetricsPlugin(metrics, WithMetricsDatabase("orders"))))
+
+	require.NoError(t, db.Table("test_users").Create(map[string]any{"name": "alice"}).Error)
+	var names []string
+	require.NoError(t, db.Table("test_users").Pluck("name", &names).Error)
+	require.NoError(t, WithPrimary(db).Table("test_users").Pluck("name", &names).Error)
+	assert.Equal(t, []string{"alice"}, names)
+
+	assert.Equal(t, float64(1), metrics.counter("db_queries_total", "orders", "primary", "test_users", "create"))
+	assert.Equal(t, float64(1), metrics.counter("db_queries_total", "orders", "replica", "test_users", "select"))
+	assert.Equal(t, float64(1), metrics.counter("db_queries_total", "orders", "primary", "test_users", "select"))
+	assert.Equal(t, float64(0), metrics.gauge("db_queries_in_flight", "orders"))
+}
+
+func TestMetricsPluginOptions(t *testing.T) {
+	metrics := newMockMetrics()
+	NewMetricsPlugin(metrics,
+		WithMetricsNamespace("shop"),
+		WithMetricsSubsystem("orders"),
+		WithDurationBuckets(0.01, 0.1, 1),
+		WithRowsBuckets(1, 100),
+		WithoutTableLabel(),
+	)
+
+	duration := metrics.options["db_query_duration_seconds"]
+	assert.Equal(t, "shop", duration.Namespace)
+	assert.Equal(t, "orders", duration.Subsystem)
+	assert.Equal(t, []float64{0.01, 0.1, 1}, duration.Buckets)
+	assert.Equal(t, []string{"database", "role", "operation"}, duration.Labels)
+	assert.Equal(t, []float64{1, 100}, metrics.options["db_rows_affected"].Buckets)
+	assert.Equal(t, []string{"database", "role", "operation", "error_type"}, metrics.options["db_query_errors_total"].Labels)
+	assert.Equal(t, "shop", metrics.options["db_queries_in_flight"].Namespace)
+}
+
+func TestMetricsPluginTableLabelLimit(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.Exec("CREATE TABLE test_users (id INTEGER PRIMARY KEY, name TEXT)").Error)
+	require.NoError(t, db.Exec("CREATE TABLE test_orders (id INTEGER PRIMARY KEY)").Error)
+
+	metrics := newMockMetrics()
+	require.NoError(t, db.Use(NewMetricsPlugin(metrics, WithTableLabelLimit(1))))
+
+	var count int64
+	require.NoError(t, db.Table("test_users").Count(&count).Error)
+	require.NoError(t, db.Table("test_orders").Count(&count).Error)
+	require.NoError(t, db.Table("test_users").Count(&count).Error)
+
+	assert.Equal(t, float64(2), metrics.counter("db_queries_total", "default", "primary", "test_users", "select"))
+	assert.Equal(t, float64(1), metrics.counter("db_queries_total", "default", "primary", "other", "select"))
+}
@@ -1,16 +1,103 @@
 package dbx
 
 import (
+	"context"
 	"fmt"
 	"io/fs"
 	"path/filepath"
 	"sort"
 	"strings"
+	"sync"
 
 	"github.com/gostratum/core/logx"
+	"github.com/gostratum/dbx/migrate"
 	"gorm.io/gorm"
 )
 
+// migrationStatus shares one migrate.StatusReader per database, so probes do
+// not open a migration runner and re-read the source on every call
+type migrationStatus struct {
+	dbCfg *DatabaseConfig
+
+	mu     sync.Mutex
+	reader *migrate.StatusReader
+}
+
+// status reads the migration status, creating the reader on first use
+func (m *migrationStatus) status(ctx context.Context) (migrate.Status, error) {
+	m.mu.Lock()
+	if m.reader == nil {
+		reader, err := newMigrationStatusReader(m.dbCfg)
+		if err != nil {
+			m.mu.Unlock()
+			return migrate.Status{}, err
+		}
+		m.reader = reader
+	}
+	reader := m.reader
+	m.mu.Unlock()
+
+	return reader.Status(ctx)
+}
+
+// close closes the reader's connection
+func (m *migrationStatus) close() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.reader == nil {
+		return nil
+	}
+	err := m.reader.Close()
+	m.reader = nil
+	return err
+}
+
+// migrationStatusOf returns the migration status registered for db, if any
+func migrationStatusOf(db *gorm.DB) *migrationStatus {
+	if s := connectionStateFor(db); s != nil {
+		return s.migration
+	}
+	return nil
+}
+
+// closeMigrationStatus closes the migration status reader registered for db
+func closeMigrationStatus(db *gorm.DB) error {
+	if m := migrationStatusOf(db); m != nil {
+		return m.close()
+	}
+	return nil
+}
+
+// newMigrationStatusReader reads the status with the configured source, or
+// from the migration table alone
+func newMigrationStatusReader(dbCfg *DatabaseConfig) (*migrate.StatusReader, error) {
+	if dbCfg.MigrationSource != "" {
+		return migrate.StatusReaderFromDatabaseConfig(dbCfg)
+	}
+
+	table := dbCfg.MigrationTable
+	if table == "" {
+		table = DefaultDatabaseConfig().MigrationTable
+	}
+	return migrate.NewStatusReader(dbCfg.GetDSN(), migrate.WithTable(table))
+}
+
+// migrationStatusFor reads the migration status of db, reusing the reader
+// registered by the module
+func migrationStatusFor(ctx context.Context, db *gorm.DB, dbCfg *DatabaseConfig) (migrate.Status, error) {
+	if m := migrationStatusOf(db); m != nil {
+		return m.status(ctx)
+	}
+
+	// Connections created outside the module
+	reader, err := newMigrationStatusReader(dbCfg)
+	if err != nil {
+		return migrate.Status{}, err
+	}
+	defer reader.Close()
+	return reader.Status(ctx)
+}
+
 // MigrationRunner handles database migrations
 type MigrationRunner struct {
 	logger      logx.Logger
@@ -2,10 +2,13 @@ package internal
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"os"
 
 	"github.com/golang-migrate/migrate/v4"
 	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source"
 	_ "github.com/golang-migrate/migrate/v4/source/file"
 	_ "github.com/golang-migrate/migrate/v4/source/iofs"
 	_ "github.com/jackc/pgx/v5/stdlib"
@@ -14,6 +17,7 @@ import (
 // Runner wraps golang-migrate operations
 type Runner struct {
 	migrate   *migrate.Migrate
+	source    source.Driver
 	dbURL     string
 	sourceURL string
 	config    *RunnerConfig
@@ -42,10 +46,16 @@ func NewRunner(ctx context.Context, dbURL, sourceURL string, config *RunnerConfi
 		}
 	}
 
-	// Create migrate instance using URLs
+	// Open the source ourselves so its versions can be listed for status
 	// The library will handle both file:// and iofs:// sources when properly registered
-	m, err := migrate.New(sourceURL, dbURL)
+	sourceDriver, err := source.Open(sourceURL)
 	if err != nil {
+		return nil, fmt.Errorf("failed to open migration source: %w", err)
+	}
+
+	m, err := migrate.NewWithSourceInstance("source", sourceDriver, dbURL)
+	if err != nil {
+		sourceDriver.Close()
 		return nil, fmt.Errorf("failed to create migrate instance: %w", err)
 	}
 
@@ -56,6 +66,7 @@ func NewRunner(ctx context.Context, dbURL, sourceURL string, config *RunnerConfi
 
 	return &Runner{
 		migrate:   m,
+		source:    sourceDriver,
 		dbURL:     dbURL,
 		sourceURL: sourceURL,
 		config:    config,
@@ -129,6 +140,32 @@ func (r *Runner) Version() (version uint, dirty bool, err error) {
 	return r.migrate.Version()
 }
 
+// CurrentVersion is Version with a database that has no migrations applied
+// reported as version 0
+func (r *Runner) CurrentVersion() (version uint, dirty bool, err error) {
+	version, dirty, err = r.migrate.Version()
+	if errors.Is(err, migrate.ErrNilVersion) {
+		return 0, false, nil
+	}
+	return version, dirty, err
+}
+
+// SourceVersions lists every migration version in the source in ascending order
+func (r *Runner) SourceVersions() ([]uint, error) {
+	versions := []uint{}
+
+	version, err := r.source.First()
+	for err == nil {
+		versions = append(versions, version)
+		version, err = r.source.Next(version)
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read migration source: %w", err)
+	}
+
+	return versions, nil
+}
+
 // Close closes the migration runner
 func (r *Runner) Close() error {
 	srcErr, dbErr := r.migrate.Close()
@@ -76,6 +76,7 @@ func NewRunnerWithEmbed(ctx context.Context, dbURL string, embedFS embed.FS, sub
 
 	return &Runner{
 		migrate:   m,
+		source:    sourceDriver,
 		dbURL:     dbURL,
 		sourceURL: "iofs://embed",
 		config:    config,
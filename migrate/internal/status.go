@@ -20,22 +20,14 @@ type Status struct {
 	DatabaseURL string
 	Current     uint
 	Dirty       bool
+	Latest      uint
 	Applied     []uint
 	Pending     []uint
 }
 
-// GetStatus retrieves the current migration status
-func GetStatus(ctx context.Context, dbURL, sourceURL, tableName string) (*Status, error) {
-	// Create a new runner to get status
-	runner, err := NewRunner(ctx, dbURL, sourceURL, &RunnerConfig{
-		Table:   tableName,
-		Verbose: false,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to create runner for status: %w", err)
-	}
-	defer runner.Close()
-
+// GetStatus retrieves the current migration status, comparing the database
+// version with the versions available in the runner's source
+func GetStatus(ctx context.Context, runner *Runner) (*Status, error) {
 	// Get current version and dirty state
 	version, dirty, err := runner.Version()
 	if err != nil {
@@ -45,38 +37,66 @@ func GetStatus(ctx context.Context, dbURL, sourceURL, tableName string) (*Status
 		dirty = false
 	}
 
+	versions, err := runner.SourceVersions()
+	if err != nil {
+		return nil, err
+	}
+
+	applied, pending := SplitVersions(versions, version, dirty)
 	status := &Status{
-		DatabaseURL: dbURL,
+		DatabaseURL: runner.dbURL,
 		Current:     version,
 		Dirty:       dirty,
-		Applied:     []uint{},
-		Pending:     []uint{},
+		Applied:     applied,
+		Pending:     pending,
 	}
-
-	// Get applied migrations from the database
-	applied, err := getAppliedMigrations(ctx, dbURL, tableName)
-	if err != nil {
-		// If table doesn't exist yet, no migrations have been applied
-		status.Applied = []uint{}
-	} else {
-		status.Applied = applied
+	if len(versions) > 0 {
+		status.Latest = versions[len(versions)-1]
 	}
 
 	return status, nil
 }
 
-// getAppliedMigrations queries the database for applied migrations
-func getAppliedMigrations(ctx context.Context, dbURL, tableName string) ([]uint, error) {
+// SplitVersions partitions source versions into applied and pending relative
+// to the current database version. A dirty current version counts as pending.
+func SplitVersions(versions []uint, current uint, dirty bool) (applied, pending []uint) {
+	applied = []uint{}
+	pending = []uint{}
+	for _, v := range versions {
+		if v < current || (v == current && !dirty) {
+			applied = append(applied, v)
+		} else {
+			pending = append(pending, v)
+		}
+	}
+	return applied, pending
+}
+
+// GetStatusWithoutSource reads the version and dirty state straight from the
+// migration table when no source is available
+func GetStatusWithoutSource(ctx context.Context, dbURL, tableName string) (*Status, error) {
 	db, err := sql.Open("pgx", dbURL)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open database: %w", err)
 	}
 	defer db.Close()
 
+	return TableStatus(ctx, db, dbURL, tableName)
+}
+
+// TableStatus reads the version and dirty state from the migration table
+// through an open database handle
+func TableStatus(ctx context.Context, db *sql.DB, dbURL, tableName string) (*Status, error) {
+	status := &Status{
+		DatabaseURL: dbURL,
+		Applied:     []uint{},
+		Pending:     []uint{},
+	}
+
 	// Check if migrations table exists
 	var exists bool
 	query := `SELECT EXISTS (
-		SELECT FROM information_schema.tables 
+		SELECT FROM information_schema.tables
 		WHERE table_name = $1
 	)`
 	if err := db.QueryRowContext(ctx, query, tableName).Scan(&exists); err != nil {
@@ -84,28 +104,26 @@ func getAppliedMigrations(ctx context.Context, dbURL, tableName string) ([]uint,
 	}
 
 	if !exists {
-		return []uint{}, nil
+		// No migrations have been applied yet
+		return status, nil
 	}
 
-	// Query applied migrations
-	rows, err := db.QueryContext(ctx, fmt.Sprintf("SELECT version FROM %s WHERE dirty = false ORDER BY version", tableName))
+	var version int64
+	err := db.QueryRowContext(ctx, fmt.Sprintf("SELECT version, dirty FROM %s LIMIT 1", tableName)).
+		Scan(&version, &status.Dirty)
+	if err == sql.ErrNoRows {
+		return status, nil
+	}
 	if err != nil {
-		return nil, fmt.Errorf("failed to query applied migrations: %w", err)
+		return nil, fmt.Errorf("failed to query migration version: %w", err)
 	}
-	defer rows.Close()
 
-	var applied []uint
-	for rows.Next() {
-		var version uint
-		if err := rows.Scan(&version); err != nil {
-			return nil, fmt.Errorf("failed to scan migration version: %w", err)
+	if version > 0 {
+		status.Current = uint(version)
+		if !status.Dirty {
+			status.Applied = []uint{status.Current}
 		}
-		applied = append(applied, version)
 	}
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating migration rows: %w", err)
-	}
-
-	return applied, nil
+	return status, nil
 }
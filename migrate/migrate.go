@@ -2,7 +2,9 @@ package migrate
 
 import (
 	"context"
+	"database/sql"
 	"fmt"
+	"sync"
 	"time"
 
 	"github.com/gostratum/dbx/migrate/internal"
@@ -13,8 +15,15 @@ type Status struct {
 	DatabaseURL string
 	Current     uint
 	Dirty       bool
-	Applied     []uint
-	Pending     []uint
+	// Latest is the highest version in the migration source (0 when unknown)
+	Latest  uint
+	Applied []uint
+	Pending []uint
+}
+
+// Behind reports whether the database is below the latest source version
+func (s Status) Behind() bool {
+	return s.Current < s.Latest
 }
 
 // Up applies all pending migrations
@@ -174,41 +183,155 @@ func GetStatus(ctx context.Context, dbURL string, opts ...Option) (Status, error
 	}
 	defer runner.Close()
 
-	version, dirty, err := runner.Version()
+	status, err := internal.GetStatus(ctx, runner)
 	if err != nil {
-		// No migrations applied yet
-		version = 0
-		dirty = false
+		return Status{}, WrapError(err, "failed to get migration status")
 	}
 
-	status, err := internal.GetStatus(ctx, dbURL, "", cfg.Table)
+	return fromInternalStatus(status), nil
+}
+
+// getStatusWithoutSource gets status when no source is available
+func getStatusWithoutSource(ctx context.Context, dbURL, tableName string) (Status, error) {
+	status, err := internal.GetStatusWithoutSource(ctx, dbURL, tableName)
 	if err != nil {
 		return Status{}, WrapError(err, "failed to get migration status")
 	}
 
-	return Status{
-		DatabaseURL: dbURL,
-		Current:     version,
+	return fromInternalStatus(status), nil
+}
+
+// StatusReader reads the migration status of one database repeatedly, e.g.
+// for health checks. It keeps one runner (or, without a source, one
+// connection) open and reads the source versions once, as they do not change
+// at runtime. It is safe for concurrent use.
+type StatusReader struct {
+	dbURL string
+	cfg   *Config
+
+	mu       sync.Mutex
+	runner   *internal.Runner
+	versions []uint
+	db       *sql.DB
+}
+
+// NewStatusReader creates a status reader. It connects on the first call to
+// Status and reconnects after a failed read.
+func NewStatusReader(dbURL string, opts ...Option) (*StatusReader, error) {
+	if dbURL == "" {
+		return nil, ErrDatabaseURLRequired
+	}
+
+	cfg := DefaultConfig()
+	cfg.Apply(opts...)
+	return &StatusReader{dbURL: dbURL, cfg: cfg}, nil
+}
+
+// StatusReaderFromDatabaseConfig creates a status reader using database configuration
+func StatusReaderFromDatabaseConfig(dbConfig DatabaseConfigInterface) (*StatusReader, error) {
+	opts, err := optionsFromDatabaseConfig(dbConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewStatusReader(dbConfig.GetDSN(), opts...)
+}
+
+// Status retrieves the current migration status
+func (r *StatusReader) Status(ctx context.Context) (Status, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cfg.Dir == "" && !r.cfg.UseEmbed {
+		return r.statusWithoutSource(ctx)
+	}
+
+	if r.runner == nil {
+		runner, err := createRunner(ctx, r.dbURL, r.cfg)
+		if err != nil {
+			return Status{}, WrapError(err, "failed to create migration runner")
+		}
+		r.runner = runner
+	}
+
+	if r.versions == nil {
+		versions, err := r.runner.SourceVersions()
+		if err != nil {
+			return Status{}, WrapError(err, "failed to get migration status")
+		}
+		r.versions = versions
+	}
+
+	current, dirty, err := r.runner.CurrentVersion()
+	if err != nil {
+		// Reconnect on the next call
+		r.runner.Close()
+		r.runner = nil
+		return Status{}, WrapError(err, "failed to get migration status")
+	}
+
+	applied, pending := internal.SplitVersions(r.versions, current, dirty)
+	status := Status{
+		DatabaseURL: r.dbURL,
+		Current:     current,
 		Dirty:       dirty,
-		Applied:     status.Applied,
-		Pending:     status.Pending,
-	}, nil
+		Applied:     applied,
+		Pending:     pending,
+	}
+	if len(r.versions) > 0 {
+		status.Latest = r.versions[len(r.versions)-1]
+	}
+	return status, nil
 }
 
-// getStatusWithoutSource gets status when no source is available
-func getStatusWithoutSource(ctx context.Context, dbURL, tableName string) (Status, error) {
-	status, err := internal.GetStatus(ctx, dbURL, "", tableName)
+// statusWithoutSource reads the migration table through the reader's connection
+func (r *StatusReader) statusWithoutSource(ctx context.Context) (Status, error) {
+	if r.db == nil {
+		db, err := sql.Open("pgx", r.dbURL)
+		if err != nil {
+			return Status{}, WrapError(err, "failed to open database")
+		}
+		db.SetMaxOpenConns(1)
+		r.db = db
+	}
+
+	status, err := internal.TableStatus(ctx, r.db, r.dbURL, r.cfg.Table)
 	if err != nil {
 		return Status{}, WrapError(err, "failed to get migration status")
 	}
 
+	return fromInternalStatus(status), nil
+}
+
+// Close closes the reader's connection
+func (r *StatusReader) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var err error
+	if r.runner != nil {
+		err = r.runner.Close()
+		r.runner = nil
+	}
+	if r.db != nil {
+		if closeErr := r.db.Close(); err == nil {
+			err = closeErr
+		}
+		r.db = nil
+	}
+	return err
+}
+
+// fromInternalStatus converts the internal status representation
+func fromInternalStatus(status *internal.Status) Status {
 	return Status{
 		DatabaseURL: status.DatabaseURL,
 		Current:     status.Current,
 		Dirty:       status.Dirty,
+		Latest:      status.Latest,
 		Applied:     status.Applied,
 		Pending:     status.Pending,
-	}, nil
+	}
 }
 
 // createRunner creates a migration runner based on config
@@ -248,9 +371,30 @@ func createRunner(ctx context.Context, dbURL string, cfg *Config) (*internal.Run
 // UpFromDatabaseConfig applies all pending migrations using database configuration
 // This provides a more integrated approach using the DatabaseConfig directly
 func UpFromDatabaseConfig(ctx context.Context, dbConfig DatabaseConfigInterface) error {
+	opts, err := optionsFromDatabaseConfig(dbConfig)
+	if err != nil {
+		return err
+	}
+
+	return Up(ctx, dbConfig.GetDSN(), opts...)
+}
+
+// StatusFromDatabaseConfig retrieves the migration status using database configuration,
+// including the pending versions and latest version of the configured source
+func StatusFromDatabaseConfig(ctx context.Context, dbConfig DatabaseConfigInterface) (Status, error) {
+	opts, err := optionsFromDatabaseConfig(dbConfig)
+	if err != nil {
+		return Status{}, err
+	}
+
+	return GetStatus(ctx, dbConfig.GetDSN(), opts...)
+}
+
+// optionsFromDatabaseConfig builds migration options from database configuration
+func optionsFromDatabaseConfig(dbConfig DatabaseConfigInterface) ([]Option, error) {
 	// Check if migrations are enabled
 	if dbConfig.GetMigrationSource() == "" {
-		return ErrNoMigrationSource
+		return nil, ErrNoMigrationSource
 	}
 
 	// Build options from database config
@@ -262,7 +406,7 @@ func UpFromDatabaseConfig(ctx context.Context, dbConfig DatabaseConfigInterface)
 		dir := dbConfig.GetMigrationSource()[7:] // Remove "file://" prefix
 		opts = append(opts, WithDir(dir))
 	} else {
-		return fmt.Errorf("invalid migration_source format: %s", dbConfig.GetMigrationSource())
+		return nil, fmt.Errorf("invalid migration_source format: %s", dbConfig.GetMigrationSource())
 	}
 
 	opts = append(opts,
@@ -274,7 +418,7 @@ func UpFromDatabaseConfig(ctx context.Context, dbConfig DatabaseConfigInterface)
 		opts = append(opts, WithVerbose())
 	}
 
-	return Up(ctx, dbConfig.GetDSN(), opts...)
+	return opts, nil
 }
 
 // DatabaseConfigInterface defines the interface for database configuration
@@ -1,9 +1,15 @@
 package migrate
 
 import (
+	"context"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
+	"github.com/gostratum/dbx/migrate/internal"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestSourceFSValidation(t *testing.T) {
@@ -46,3 +52,95 @@ func TestWrapError(t *testing.T) {
 		assert.ErrorIs(t, wrappedErr, ErrNoChange)
 	})
 }
+
+func TestSplitVersions(t *testing.T) {
+	versions := []uint{1, 2, 3, 4}
+
+	applied, pending := internal.SplitVersions(versions, 2, false)
+	assert.Equal(t, []uint{1, 2}, applied)
+	assert.Equal(t, []uint{3, 4}, pending)
+
+	applied, pending = internal.SplitVersions(versions, 2, true)
+	assert.Equal(t, []uint{1}, applied)
+	assert.Equal(t, []uint{2, 3, 4}, pending)
+
+	applied, pending = internal.SplitVersions(versions, 0, false)
+	assert.Empty(t, applied)
+	assert.Equal(t, versions, pending)
+}
+
+func TestStatusBehind(t *testing.T) {
+	assert.True(t, Status{Current: 2, Latest: 4}.Behind())
+	assert.False(t, Status{Current: 4, Latest: 4}.Behind())
+	assert.False(t, Status{Current: 3}.Behind(), "unknown latest is never behind")
+}
+
+func TestStatusFromDatabaseConfig_NoSource(t *testing.T) {
+	_, err := StatusFromDatabaseConfig(context.Background(), &mockDatabaseConfig{})
+	assert.ErrorIs(t, err, ErrNoMigrationSource)
+}
+
+func TestNewStatusReader_RequiresURL(t *testing.T) {
+	_, err := NewStatusReader("")
+	assert.ErrorIs(t, err, ErrDatabaseURLRequired)
+
+	_, err = StatusReaderFromDatabaseConfig(&mockDatabaseConfig{dsn: "postgres://localhost/app"})
+	assert.ErrorIs(t, err, ErrNoMigrationSource)
+}
+
+func TestStatusReader(t *testing.T) {
+	// Needs a live Postgres, like the dbx package integration tests
+	dsn := os.Getenv("DBX_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("DBX_TEST_POSTGRES_DSN not set")
+	}
+
+	dir := t.TempDir()
+	writeMigration := func(name string) {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), []byte("SELECT 1;"), 0o644))
+	}
+	writeMigration("1_first.up.sql")
+	writeMigration("2_second.up.sql")
+
+	table := "dbx_status_reader_test"
+	reader, err := NewStatusReader(dsn, WithDir(dir), WithTable(table))
+	require.NoError(t, err)
+	defer reader.Close()
+
+	ctx := context.Background()
+	status, err := reader.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint(0), status.Current)
+	assert.Equal(t, uint(2), status.Latest)
+	assert.Equal(t, []uint{1, 2}, status.Pending)
+	runner := reader.runner
+
+	// Source versions are read once and the runner is reused
+	writeMigration("3_third.up.sql")
+	status, err = reader.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint(2), status.Latest)
+	assert.Same(t, runner, reader.runner)
+
+	require.NoError(t, reader.Close())
+	assert.Nil(t, reader.runner)
+
+	withoutSource, err := NewStatusReader(dsn, WithTable(table))
+	require.NoError(t, err)
+	defer withoutSource.Close()
+	status, err = withoutSource.Status(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint(0), status.Latest)
+}
+
+// mockDatabaseConfig implements DatabaseConfigInterface for tests
+type mockDatabaseConfig struct {
+	dsn    string
+	source string
+}
+
+func (m *mockDatabaseConfig) GetDSN() string                         { return m.dsn }
+func (m *mockDatabaseConfig) GetMigrationSource() string             { return m.source }
+func (m *mockDatabaseConfig) GetMigrationTable() string              { return "schema_migrations" }
+func (m *mockDatabaseConfig) GetMigrationLockTimeout() time.Duration { return 15 * time.Second }
+func (m *mockDatabaseConfig) GetMigrationVerbose() bool              { return false }
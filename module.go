@@ -64,6 +64,22 @@ type moduleConfig struct {
 	useGolangMigrate      bool
 	golangMigrateUseEmbed bool
 	golangMigrateDir      string
+	// Two-phase commit coordinator
+	txCoordinatorDB   string
+	txCoordinatorOpts []CoordinatorOption
+	// Diagnostics handler options
+	diagnosticsOpts []DiagnosticsOption
+	// User-defined health checks
+	customHealthChecks []CustomHealthCheck
+	// Extra context fields for SQL logs
+	logContextFields []ContextFieldExtractor
+	// Metrics plugin options
+	metricsOpts []MetricsOption
+	// Log level handler options
+	logLevelOpts []LogLevelHandlerOption
+	// OpenTelemetry tracing
+	tracing     bool
+	tracingOpts []TracingOption
 }
 
 // WithDefault sets the default database connection name
@@ -137,6 +153,69 @@ func WithGolangMigrateDir(dir string) Option {
 	}
 }
 
+// WithTxCoordinator enables the two-phase commit coordinator. The decision
+// log is stored in the named database and in-doubt prepared transactions are
+// recovered at startup and periodically (see WithRecoveryInterval).
+func WithTxCoordinator(logDatabase string, opts ...CoordinatorOption) Option {
+	return func(cfg *moduleConfig) {
+		cfg.txCoordinatorDB = logDatabase
+		cfg.txCoordinatorOpts = opts
+	}
+}
+
+// WithHealthCheck registers user-defined health checks, e.g. created with
+// HealthCheckFunc. Checks can also be provided to the HealthCheckGroup fx group.
+func WithHealthCheck(checks ...CustomHealthCheck) Option {
+	return func(cfg *moduleConfig) {
+		cfg.customHealthChecks = append(cfg.customHealthChecks, checks...)
+	}
+}
+
+// WithLogContextFields attaches request-scoped fields from the query context to
+// SQL logs, e.g. dbx.ContextValueField("request_id", requestIDKey{})
+func WithLogContextFields(extractors ...ContextFieldExtractor) Option {
+	return func(cfg *moduleConfig) {
+		cfg.logContextFields = append(cfg.logContextFields, extractors...)
+	}
+}
+
+// WithMetricsOptions configures the MetricsPlugin registered on every database.
+// The namespace and subsystem also apply to pool, transaction and outbox metrics.
+func WithMetricsOptions(opts ...MetricsOption) Option {
+	return func(cfg *moduleConfig) {
+		cfg.metricsOpts = append(cfg.metricsOpts, opts...)
+	}
+}
+
+// scopedMetrics applies the namespace and subsystem of the metrics options
+func (c *moduleConfig) scopedMetrics(metrics metricsx.Metrics) metricsx.Metrics {
+	return newMetricsPlugin(c.metricsOpts...).scoped(metrics)
+}
+
+// WithTracing registers a TracingPlugin on every database
+func WithTracing(opts ...TracingOption) Option {
+	return func(cfg *moduleConfig) {
+		cfg.tracing = true
+		cfg.tracingOpts = append(cfg.tracingOpts, opts...)
+	}
+}
+
+// WithLogLevelHandler configures the *LogLevelHandler provided by the module,
+// e.g. to add an authorization hook
+func WithLogLevelHandler(opts ...LogLevelHandlerOption) Option {
+	return func(cfg *moduleConfig) {
+		cfg.logLevelOpts = append(cfg.logLevelOpts, opts...)
+	}
+}
+
+// WithDiagnostics configures the *DiagnosticsHandler provided by the module,
+// e.g. to add an authorization hook
+func WithDiagnostics(opts ...DiagnosticsOption) Option {
+	return func(cfg *moduleConfig) {
+		cfg.diagnosticsOpts = append(cfg.diagnosticsOpts, opts...)
+	}
+}
+
 // Module creates the dbx Fx module
 func Module(opts ...Option) fx.Option {
 	cfg := &moduleConfig{
@@ -152,10 +231,16 @@ func Module(opts ...Option) fx.Option {
 	}
 
 	return fx.Module("dbx",
-		// Provide database connections
+		// Provide database configuration and connections
 		fx.Provide(
-			func(loader configx.Loader, logger logx.Logger) (Connections, error) {
-				return newConnections(loader, logger, cfg)
+			func(loader configx.Loader) (*Config, error) {
+				return loadConfig(loader)
+			},
+			func(dbConfig *Config, logger logx.Logger) (Connections, error) {
+				return newConnections(dbConfig, logger, cfg)
+			},
+			func(dbConfig *Config) Outboxes {
+				return newOutboxes(dbConfig)
 			},
 		),
 		// Provide the default database connection
@@ -190,14 +275,50 @@ func Module(opts ...Option) fx.Option {
 				return NewMigrationRunner(logger, connections, opts...)
 			},
 		),
+		// Provide two-phase commit coordinator if enabled
+		fx.Provide(
+			func(connections Connections, logger logx.Logger) (*TxCoordinator, error) {
+				if cfg.txCoordinatorDB == "" {
+					return nil, nil
+				}
+				return NewTxCoordinator(connections, cfg.txCoordinatorDB, logger, cfg.txCoordinatorOpts...)
+			},
+		),
+		// Provide the diagnostics HTTP handler for mounting by the application
+		fx.Provide(func(connections Connections, dbConfig *Config, logger logx.Logger) *DiagnosticsHandler {
+			h := NewDiagnosticsHandler(connections, dbConfig, cfg.diagnosticsOpts...)
+			if h.authorize == nil {
+				logger.Warn("Diagnostics handler has no authorizer and rejects all requests; configure dbx.WithDiagnosticsAuth")
+			}
+			return h
+		}),
+		// Provide runtime log level control and its HTTP handler
+		fx.Provide(NewLogLevelController),
+		fx.Provide(func(controller *LogLevelController, logger logx.Logger) *LogLevelHandler {
+			h := NewLogLevelHandler(controller, cfg.logLevelOpts...)
+			if h.authorize == nil {
+				logger.Warn("Log level handler has no authorizer and rejects all requests; configure dbx.WithLogLevelAuth")
+			}
+			return h
+		}),
 		// Provide health checker if enabled
 		fx.Provide(
 			fx.Annotated{
-				Target: func(connections Connections, registry core.Registry) *HealthChecker {
+				Target: func(params struct {
+					fx.In
+					Connections  Connections
+					Registry     core.Registry
+					Config       *Config
+					CustomChecks []CustomHealthCheck `group:"dbx_health_checks"`
+				}) *HealthChecker {
 					if !cfg.healthChecks {
 						return nil
 					}
-					return NewHealthChecker(connections, registry)
+					return NewHealthChecker(params.Connections, params.Registry,
+						WithHealthConfig(params.Config),
+						WithCustomHealthChecks(cfg.customHealthChecks...),
+						WithCustomHealthChecks(params.CustomChecks...),
+					)
 				},
 				Group: "health_checkers",
 			},
@@ -218,20 +339,30 @@ func Module(opts ...Option) fx.Option {
 
 				// Channel to stop metrics collection
 				stopChan := make(chan struct{})
+				metrics := cfg.scopedMetrics(params.Metrics)
+
+				// Query event context fields match the SQL log fields
+				metricsOpts := append([]MetricsOption{WithEventContextFields(cfg.logContextFields...)}, cfg.metricsOpts...)
+				var plugins []*MetricsPlugin
 
 				for name, db := range params.Connections {
 					// Register metrics plugin
-					plugin := NewMetricsPlugin(params.Metrics)
+					plugin := NewMetricsPlugin(params.Metrics, append([]MetricsOption{WithMetricsDatabase(name)}, metricsOpts...)...)
 					if err := db.Use(plugin); err != nil {
 						params.Logger.Error("dbx: failed to register metrics plugin",
 							logx.String("database", name),
 							logx.Err(err),
 						)
+						plugin.Close()
 						continue
 					}
+					plugins = append(plugins, plugin)
 
 					// Start connection pool metrics collector with context
-					ConnectionPoolMetricsWithContext(params.Metrics, db, name, stopChan)
+					ConnectionPoolMetricsWithContext(metrics, db, name, stopChan)
+
+					// Enable transaction lifecycle metrics
+					txStateFor(db).setMetrics(metrics, cfg.metricsOpts...)
 
 					params.Logger.Info("dbx: metrics enabled for database", logx.String("database", name))
 				}
@@ -241,6 +372,10 @@ func Module(opts ...Option) fx.Option {
 					OnStop: func(ctx context.Context) error {
 						params.Logger.Info("dbx: stopping metrics collection")
 						close(stopChan)
+						// Deliver buffered query events
+						for _, plugin := range plugins {
+							plugin.Close()
+						}
 						return nil
 					},
 				})
@@ -251,6 +386,7 @@ func Module(opts ...Option) fx.Option {
 			fx.In
 			Logger          logx.Logger
 			Loader          configx.Loader
+			Config          *Config
 			Connections     Connections
 			MigrationRunner *MigrationRunner
 			// Accept health checkers as a group; it's optional so modules that
@@ -261,11 +397,22 @@ func Module(opts ...Option) fx.Option {
 				OnStart: func(ctx context.Context) error {
 					params.Logger.Info("Starting dbx module")
 
-					// Test all connections
+					// Test all connections and verify server compatibility
 					for name, db := range params.Connections {
 						if err := testConnection(ctx, name, db, params.Logger); err != nil {
 							return err
 						}
+						if err := verifyServer(ctx, name, db, params.Config.Databases[name], params.Logger); err != nil {
+							return fmt.Errorf("server compatibility check failed: %w", err)
+						}
+					}
+
+					// Start long-transaction watchdogs and log sampling summaries
+					for _, db := range params.Connections {
+						txStateFor(db).startWatchdog()
+						if l, ok := db.Logger.(*gormLoggerAdapter); ok {
+							l.startSampling()
+						}
 					}
 
 					// Run golang-migrate migrations if enabled
@@ -291,10 +438,9 @@ func Module(opts ...Option) fx.Option {
 								continue
 							}
 							if err := hc.RegisterHealthChecks(); err != nil {
-								params.Logger.Error("Failed to register health checks", logx.Err(err))
-							} else {
-								params.Logger.Info("Health checks registered", logx.Int("databases", len(params.Connections)))
+								return fmt.Errorf("failed to register health checks: %w", err)
 							}
+							params.Logger.Info("Health checks registered", logx.Int("databases", len(params.Connections)))
 						}
 					}
 
@@ -304,8 +450,28 @@ func Module(opts ...Option) fx.Option {
 				OnStop: func(ctx context.Context) error {
 					params.Logger.Info("Stopping dbx module")
 
+					for _, db := range params.Connections {
+						p := txStateFor(db)
+						p.stopWatchdog()
+						p.reportLeaks()
+						if l, ok := db.Logger.(*gormLoggerAdapter); ok {
+							l.stopSampling()
+						}
+					}
+
 					// Close all connections
 					for name, db := range params.Connections {
+						if err := closeReplicas(db); err != nil {
+							params.Logger.Error("Failed to close read replica connections",
+								logx.String("database", name),
+								logx.Err(err))
+						}
+						if err := closeMigrationStatus(db); err != nil {
+							params.Logger.Error("Failed to close migration status connection",
+								logx.String("database", name),
+								logx.Err(err))
+						}
+						connectionStates.unregister(name, db)
 						if sqlDB, err := db.DB(); err == nil {
 							if err := sqlDB.Close(); err != nil {
 								params.Logger.Error("Failed to close database connection",
@@ -322,11 +488,99 @@ func Module(opts ...Option) fx.Option {
 				},
 			})
 		}),
+		// Recover in-doubt distributed transactions at startup
+		fx.Invoke(func(lc fx.Lifecycle, logger logx.Logger, coordinator *TxCoordinator) {
+			if coordinator == nil {
+				return
+			}
+
+			lc.Append(fx.Hook{
+				OnStart: func(ctx context.Context) error {
+					if err := coordinator.EnsureLogTable(ctx); err != nil {
+						return err
+					}
+
+					resolved, err := coordinator.Recover(ctx)
+					if err != nil {
+						return fmt.Errorf("distributed transaction recovery failed: %w", err)
+					}
+
+					logger.Info("Distributed transaction recovery completed", logx.Int("resolved", resolved))
+					coordinator.startRecovery()
+					return nil
+				},
+				OnStop: func(ctx context.Context) error {
+					coordinator.stopRecovery()
+					return nil
+				},
+			})
+		}),
+		// Outbox relay workers for databases with the outbox enabled
+		fx.Invoke(func(lc fx.Lifecycle, params struct {
+			fx.In
+			Logger      logx.Logger
+			Config      *Config
+			Connections Connections
+			Outboxes    Outboxes
+			Publisher   OutboxPublisher  `optional:"true"`
+			Metrics     metricsx.Metrics `optional:"true"`
+		}) {
+			if len(params.Outboxes) == 0 {
+				return
+			}
+
+			var relays []*OutboxRelay
+
+			lc.Append(fx.Hook{
+				OnStart: func(ctx context.Context) error {
+					for name, outbox := range params.Outboxes {
+						db, ok := params.Connections[name]
+						if !ok {
+							continue
+						}
+
+						if err := EnsureOutboxTable(ctx, db, outbox.Table()); err != nil {
+							return fmt.Errorf("outbox setup failed for %s: %w", name, err)
+						}
+
+						if params.Publisher == nil {
+							params.Logger.Warn("dbx: outbox enabled but no OutboxPublisher provided, relay not started",
+								logx.String("database", name))
+							continue
+						}
+
+						relay := NewOutboxRelay(name, db, params.Config.Databases[name].Outbox, params.Publisher, params.Logger, cfg.scopedMetrics(params.Metrics))
+						relay.Start()
+						relays = append(relays, relay)
+					}
+					return nil
+				},
+				OnStop: func(ctx context.Context) error {
+					for _, relay := range relays {
+						if err := relay.Stop(ctx); err != nil {
+							params.Logger.Error("Failed to stop outbox relay", logx.Err(err))
+						}
+					}
+					return nil
+				},
+			})
+		}),
 	)
 }
 
-// newConnections creates database connections based on configuration
-func newConnections(loader configx.Loader, logger logx.Logger, cfg *moduleConfig) (Connections, error) {
+// newOutboxes creates outboxes for databases with the outbox enabled
+func newOutboxes(dbConfig *Config) Outboxes {
+	outboxes := make(Outboxes)
+	for name, dbCfg := range dbConfig.Databases {
+		if dbCfg != nil && dbCfg.Outbox.Enabled {
+			outboxes[name] = NewOutbox(name, dbCfg.Outbox)
+		}
+	}
+	return outboxes
+}
+
+// loadConfig loads and validates the database configuration
+func loadConfig(loader configx.Loader) (*Config, error) {
 	// Load configuration using core configx pattern
 	dbConfig := DefaultConfig()
 
@@ -351,6 +605,11 @@ func newConnections(loader configx.Loader, logger logx.Logger, cfg *moduleConfig
 		return nil, fmt.Errorf("invalid database configuration: %w", err)
 	}
 
+	return dbConfig, nil
+}
+
+// newConnections creates database connections based on configuration
+func newConnections(dbConfig *Config, logger logx.Logger, cfg *moduleConfig) (Connections, error) {
 	connections := make(Connections)
 
 	for name, dbCfg := range dbConfig.Databases {
@@ -368,18 +627,40 @@ func newConnections(loader configx.Loader, logger logx.Logger, cfg *moduleConfig
 func createConnection(name string, dbCfg *DatabaseConfig, logger logx.Logger, cfg *moduleConfig) (*gorm.DB, error) {
 	logger.Info("Creating database connection", logx.String("database", name), logx.String("driver", dbCfg.Driver))
 
+	loggerOpts := []GormLoggerOption{
+		WithDatabaseName(name),
+		WithContextFields(cfg.logContextFields...),
+		WithSQLMode(dbCfg.LogSQLMode),
+		WithRedactedColumns(dbCfg.LogRedactColumns...),
+		WithLogSampling(dbCfg.LogSampleBurst, dbCfg.LogSampleInterval),
+	}
+	var explainer *queryExplainer
+	if dbCfg.ExplainSlowQueries {
+		explainer = newQueryExplainer(dbCfg, logger.With(logx.String("database", name)))
+		loggerOpts = append(loggerOpts, withExplainer(explainer))
+	}
+	gormLogger := NewGormLogger(logger, dbCfg.LogLevel, dbCfg.SlowThreshold, loggerOpts...)
+
 	// Create GORM config
 	gormCfg := &gorm.Config{
 		SkipDefaultTransaction: dbCfg.SkipDefaultTx,
 		PrepareStmt:            dbCfg.PrepareStmt,
-		Logger:                 NewGormLogger(logger, dbCfg.LogLevel, dbCfg.SlowThreshold),
+		Logger:                 gormLogger,
 	}
 
-	// Override with custom config if provided
+	// Override with custom config if provided. It is copied so the caller's
+	// config is left untouched and databases do not share a plugin map.
 	if cfg.gormConfig != nil {
-		gormCfg = cfg.gormConfig
+		custom := *cfg.gormConfig
+		if custom.Plugins != nil {
+			custom.Plugins = make(map[string]gorm.Plugin, len(cfg.gormConfig.Plugins))
+			for k, v := range cfg.gormConfig.Plugins {
+				custom.Plugins[k] = v
+			}
+		}
+		gormCfg = &custom
 		// But still use our logger
-		gormCfg.Logger = NewGormLogger(logger, dbCfg.LogLevel, dbCfg.SlowThreshold)
+		gormCfg.Logger = gormLogger
 	}
 
 	// Create database connection based on driver
@@ -408,6 +689,48 @@ func createConnection(name string, dbCfg *DatabaseConfig, logger logx.Logger, cf
 	sqlDB.SetConnMaxLifetime(dbCfg.ConnMaxLifetime)
 	sqlDB.SetConnMaxIdleTime(dbCfg.ConnMaxIdleTime)
 
+	// Register per-connection state: transaction defaults and tracking, the
+	// server version detected at startup and, for Postgres, the migration
+	// status reused by the readiness check and diagnostics
+	state := &connectionState{
+		tx:     newTxState(name, dbCfg, logger),
+		server: &serverInfo{},
+	}
+	if dbCfg.Driver == "postgres" {
+		state.migration = &migrationStatus{dbCfg: dbCfg}
+	}
+	if err := connectionStates.register(name, db, state); err != nil {
+		return nil, fmt.Errorf("failed to register connection state: %w", err)
+	}
+
+	// Lets the logger see statements with placeholders and their parameters
+	if (dbCfg.LogSQLMode != "" && dbCfg.LogSQLMode != LogSQLFull) || explainer != nil {
+		if err := db.Use(&statementPlugin{}); err != nil {
+			return nil, fmt.Errorf("failed to register statement logging: %w", err)
+		}
+	}
+
+	// Captures plans of slow queries on the raw pool
+	if explainer != nil {
+		if err := db.Use(explainer); err != nil {
+			return nil, fmt.Errorf("failed to register explain plugin: %w", err)
+		}
+	}
+
+	// Trace operations and transactions
+	if cfg.tracing {
+		if err := db.Use(NewTracingPlugin(name, cfg.tracingOpts...)); err != nil {
+			return nil, fmt.Errorf("failed to register tracing plugin: %w", err)
+		}
+	}
+
+	// Tag statements for pg_stat_activity and server logs
+	if dbCfg.SQLComment.Enabled {
+		if err := db.Use(newSQLCommenter(name, dbCfg.SQLComment)); err != nil {
+			return nil, fmt.Errorf("failed to register sql comment plugin: %w", err)
+		}
+	}
+
 	// Configure read replicas if specified
 	if len(dbCfg.ReadReplicas) > 0 {
 		if err := configureReadReplicas(db, dbCfg.ReadReplicas, logger); err != nil {
@@ -0,0 +1,456 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/gostratum/core/logx"
+	"github.com/gostratum/metricsx"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const defaultOutboxTable = "dbx_outbox"
+
+// maxOutboxErrorLength bounds the error text stored with a failed message
+const maxOutboxErrorLength = 1024
+
+// outboxPurgeInterval is how often the relay deletes expired delivered messages
+const outboxPurgeInterval = time.Minute
+
+var (
+	// ErrOutboxNotInTransaction is returned when messages are enqueued outside a transaction
+	ErrOutboxNotInTransaction = errors.New("outbox messages must be enqueued inside a transaction")
+
+	// ErrOutboxTopicRequired is returned when a message has no topic
+	ErrOutboxTopicRequired = errors.New("outbox message topic is required")
+)
+
+// OutboxMessage is a message stored in the transactional outbox table
+type OutboxMessage struct {
+	ID          uint64            `gorm:"primaryKey;autoIncrement" json:"id"`
+	Topic       string            `gorm:"size:255;not null;index" json:"topic"`
+	Key         string            `gorm:"column:message_key;size:255" json:"key,omitempty"`
+	Payload     []byte            `gorm:"not null" json:"payload"`
+	Headers     map[string]string `gorm:"serializer:json" json:"headers,omitempty"`
+	Attempts    int               `gorm:"not null;default:0" json:"attempts"`
+	LastError   string            `json:"last_error,omitempty"`
+	AvailableAt time.Time         `gorm:"not null;index" json:"available_at"`
+	CreatedAt   time.Time         `json:"created_at"`
+	DeliveredAt *time.Time        `gorm:"index" json:"delivered_at,omitempty"`
+}
+
+// TableName returns the default outbox table name
+func (OutboxMessage) TableName() string {
+	return defaultOutboxTable
+}
+
+// OutboxPublisher delivers outbox messages to a message broker.
+// Provide an implementation via fx to enable the relay worker.
+// Returning an error marks the whole batch for retry.
+type OutboxPublisher interface {
+	Publish(ctx context.Context, msgs []OutboxMessage) error
+}
+
+// Outboxes maps database names to their outbox
+type Outboxes map[string]*Outbox
+
+// Get returns the outbox for a database, or nil if it is not enabled
+func (o Outboxes) Get(name string) *Outbox {
+	return o[name]
+}
+
+// Outbox writes messages into the outbox table of a single database
+type Outbox struct {
+	name  string
+	table string
+}
+
+// NewOutbox creates an outbox for the named database
+func NewOutbox(name string, cfg OutboxConfig) *Outbox {
+	cfg = cfg.withDefaults()
+	return &Outbox{
+		name:  name,
+		table: cfg.Table,
+	}
+}
+
+// Table returns the outbox table name
+func (o *Outbox) Table() string {
+	return o.table
+}
+
+// Enqueue stores messages in the outbox as part of the given transaction.
+// Call it with the tx passed to a WithTx/WithTxContext closure so the
+// messages are committed or rolled back together with the business data.
+func (o *Outbox) Enqueue(ctx context.Context, tx *gorm.DB, msgs ...OutboxMessage) error {
+	if len(msgs) == 0 {
+		return nil
+	}
+
+	if _, ok := tx.Statement.ConnPool.(gorm.TxCommitter); !ok {
+		return ErrOutboxNotInTransaction
+	}
+
+	now := time.Now().UTC()
+	records := make([]OutboxMessage, len(msgs))
+	for i, msg := range msgs {
+		if msg.Topic == "" {
+			return ErrOutboxTopicRequired
+		}
+		msg.ID = 0
+		msg.Attempts = 0
+		msg.LastError = ""
+		msg.DeliveredAt = nil
+		msg.CreatedAt = now
+		if msg.AvailableAt.IsZero() {
+			msg.AvailableAt = now
+		}
+		records[i] = msg
+	}
+
+	if err := tx.WithContext(ctx).Table(o.table).Create(&records).Error; err != nil {
+		return fmt.Errorf("failed to enqueue outbox messages: %w", err)
+	}
+
+	return nil
+}
+
+// EnsureOutboxTable creates or updates the outbox table
+func EnsureOutboxTable(ctx context.Context, db *gorm.DB, table string) error {
+	if table == "" {
+		table = defaultOutboxTable
+	}
+	if err := db.WithContext(ctx).Table(table).AutoMigrate(&OutboxMessage{}); err != nil {
+		return fmt.Errorf("failed to migrate outbox table %s: %w", table, err)
+	}
+	return nil
+}
+
+// OutboxRelay polls the outbox table and hands pending messages to a publisher
+type OutboxRelay struct {
+	name      string
+	db        *gorm.DB
+	cfg       OutboxConfig
+	publisher OutboxPublisher
+	logger    logx.Logger
+	metrics   *outboxMetrics
+
+	mu     sync.Mutex
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// NewOutboxRelay creates a relay worker for the named database.
+// metrics may be nil to disable outbox metrics.
+func NewOutboxRelay(name string, db *gorm.DB, cfg OutboxConfig, publisher OutboxPublisher, logger logx.Logger, metrics metricsx.Metrics) *OutboxRelay {
+	return &OutboxRelay{
+		name:      name,
+		db:        db,
+		cfg:       cfg.withDefaults(),
+		publisher: publisher,
+		logger:    logger.With(logx.String("component", "outbox"), logx.String("database", name)),
+		metrics:   newOutboxMetrics(metrics),
+	}
+}
+
+// Start launches the polling loop in the background
+func (r *OutboxRelay) Start() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancel != nil {
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+	r.done = make(chan struct{})
+
+	go r.run(ctx, r.done)
+}
+
+// Stop stops the polling loop and waits for the in-flight batch to finish
+func (r *OutboxRelay) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	cancel, done := r.cancel, r.done
+	r.cancel, r.done = nil, nil
+	r.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+
+	cancel()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run is the polling loop
+func (r *OutboxRelay) run(ctx context.Context, done chan struct{}) {
+	defer close(done)
+
+	r.logger.Info("Outbox relay started",
+		logx.String("table", r.cfg.Table),
+		logx.Duration("poll_interval", r.cfg.PollInterval),
+	)
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+
+	var lastPurge time.Time
+	for {
+		select {
+		case <-ctx.Done():
+			r.logger.Info("Outbox relay stopped")
+			return
+		case <-timer.C:
+		}
+
+		processed, err := r.RelayOnce(ctx)
+		if err != nil && ctx.Err() == nil {
+			r.logger.Error("Outbox relay iteration failed", logx.Err(err))
+		}
+		if time.Since(lastPurge) >= outboxPurgeInterval && ctx.Err() == nil {
+			lastPurge = time.Now()
+			if _, err := r.Purge(ctx); err != nil && ctx.Err() == nil {
+				r.logger.Warn("Failed to purge delivered outbox messages", logx.Err(err))
+			}
+		}
+		r.updateBacklog(ctx)
+
+		// Drain immediately while full batches keep coming
+		if err == nil && processed >= r.cfg.BatchSize {
+			timer.Reset(0)
+		} else {
+			timer.Reset(r.cfg.PollInterval)
+		}
+	}
+}
+
+// RelayOnce locks one batch of pending messages with FOR UPDATE SKIP LOCKED,
+// publishes it and records the outcome. It returns the number of messages
+// handed to the publisher.
+func (r *OutboxRelay) RelayOnce(ctx context.Context) (int, error) {
+	var (
+		processed  int
+		publishErr error
+	)
+
+	err := r.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().UTC()
+
+		var msgs []OutboxMessage
+		if err := tx.Table(r.cfg.Table).
+			Clauses(clause.Locking{Strength: clause.LockingStrengthUpdate, Options: clause.LockingOptionsSkipLocked}).
+			Where("delivered_at IS NULL AND available_at <= ? AND attempts < ?", now, r.cfg.MaxAttempts).
+			Order("id").
+			Limit(r.cfg.BatchSize).
+			Find(&msgs).Error; err != nil {
+			return fmt.Errorf("failed to fetch outbox messages: %w", err)
+		}
+
+		if len(msgs) == 0 {
+			return nil
+		}
+		processed = len(msgs)
+
+		if err := r.publisher.Publish(ctx, msgs); err != nil {
+			publishErr = err
+			return r.markFailed(tx, msgs, err, now)
+		}
+
+		ids := make([]uint64, len(msgs))
+		for i, msg := range msgs {
+			ids[i] = msg.ID
+		}
+
+		if err := tx.Table(r.cfg.Table).
+			Where("id IN ?", ids).
+			Updates(map[string]any{"delivered_at": now, "last_error": ""}).Error; err != nil {
+			return fmt.Errorf("failed to mark outbox messages delivered: %w", err)
+		}
+
+		r.metrics.published(r.name, len(msgs))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if publishErr != nil {
+		r.metrics.failed(r.name, processed)
+		return processed, fmt.Errorf("failed to publish %d outbox messages: %w", processed, publishErr)
+	}
+
+	return processed, nil
+}
+
+// markFailed records a failed delivery attempt and schedules the retry
+func (r *OutboxRelay) markFailed(tx *gorm.DB, msgs []OutboxMessage, cause error, now time.Time) error {
+	errText := cause.Error()
+	if len(errText) > maxOutboxErrorLength {
+		errText = errText[:maxOutboxErrorLength]
+	}
+
+	for _, msg := range msgs {
+		attempts := msg.Attempts + 1
+		updates := map[string]any{
+			"attempts":     attempts,
+			"last_error":   errText,
+			"available_at": now.Add(outboxBackoff(attempts, r.cfg.BackoffBase, r.cfg.BackoffMax)),
+		}
+
+		if err := tx.Table(r.cfg.Table).Where("id = ?", msg.ID).Updates(updates).Error; err != nil {
+			return fmt.Errorf("failed to record outbox delivery attempt: %w", err)
+		}
+
+		if attempts >= r.cfg.MaxAttempts {
+			r.logger.Error("Outbox message exceeded max delivery attempts",
+				logx.Any("id", msg.ID),
+				logx.String("topic", msg.Topic),
+				logx.Int("attempts", attempts),
+				logx.String("error", errText),
+			)
+		}
+	}
+
+	return nil
+}
+
+// Purge deletes messages delivered longer ago than the retention period and
+// returns how many were deleted. The relay calls it every minute.
+func (r *OutboxRelay) Purge(ctx context.Context) (int64, error) {
+	cutoff := time.Now().UTC().Add(-r.cfg.Retention)
+	res := r.db.WithContext(ctx).Table(r.cfg.Table).
+		Where("delivered_at IS NOT NULL AND delivered_at < ?", cutoff).
+		Delete(&OutboxMessage{})
+	if res.Error != nil {
+		return 0, fmt.Errorf("failed to purge delivered outbox messages: %w", res.Error)
+	}
+
+	if res.RowsAffected > 0 {
+		r.logger.Debug("Purged delivered outbox messages", logx.Int64("deleted", res.RowsAffected))
+	}
+	return res.RowsAffected, nil
+}
+
+// updateBacklog refreshes the backlog and lag gauges
+func (r *OutboxRelay) updateBacklog(ctx context.Context) {
+	if r.metrics == nil || ctx.Err() != nil {
+		return
+	}
+
+	backlog, oldest, err := r.Backlog(ctx)
+	if err != nil {
+		r.logger.Warn("Failed to read outbox backlog", logx.Err(err))
+		return
+	}
+
+	lag := 0.0
+	if !oldest.IsZero() {
+		lag = time.Since(oldest).Seconds()
+	}
+	r.metrics.backlog.Set(float64(backlog), r.name)
+	r.metrics.lag.Set(lag, r.name)
+}
+
+// Backlog returns the number of undelivered messages that are still eligible
+// for delivery and the creation time of the oldest one
+func (r *OutboxRelay) Backlog(ctx context.Context) (int64, time.Time, error) {
+	pending := func() *gorm.DB {
+		return r.db.WithContext(ctx).Table(r.cfg.Table).
+			Where("delivered_at IS NULL AND attempts < ?", r.cfg.MaxAttempts)
+	}
+
+	var count int64
+	if err := pending().Count(&count).Error; err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to count outbox backlog: %w", err)
+	}
+
+	if count == 0 {
+		return 0, time.Time{}, nil
+	}
+
+	var oldest []OutboxMessage
+	if err := pending().Order("id").Limit(1).Find(&oldest).Error; err != nil {
+		return 0, time.Time{}, fmt.Errorf("failed to read oldest outbox message: %w", err)
+	}
+
+	if len(oldest) == 0 {
+		return count, time.Time{}, nil
+	}
+
+	return count, oldest[0].CreatedAt, nil
+}
+
+// outboxBackoff returns the exponential retry delay for the given attempt
+func outboxBackoff(attempt int, base, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
+
+// outboxMetrics holds the relay metric collectors
+type outboxMetrics struct {
+	publishedTotal metricsx.Counter
+	failuresTotal  metricsx.Counter
+	backlog        metricsx.Gauge
+	lag            metricsx.Gauge
+}
+
+// newOutboxMetrics creates the relay metric collectors, or nil without metrics
+func newOutboxMetrics(metrics metricsx.Metrics) *outboxMetrics {
+	if metrics == nil {
+		return nil
+	}
+
+	return &outboxMetrics{
+		publishedTotal: metrics.Counter(
+			"db_outbox_published_total",
+			metricsx.WithHelp("Total number of outbox messages delivered to the publisher"),
+			metricsx.WithLabels("database"),
+		),
+		failuresTotal: metrics.Counter(
+			"db_outbox_failures_total",
+			metricsx.WithHelp("Total number of failed outbox message delivery attempts"),
+			metricsx.WithLabels("database"),
+		),
+		backlog: metrics.Gauge(
+			"db_outbox_backlog",
+			metricsx.WithHelp("Number of outbox messages waiting to be delivered"),
+			metricsx.WithLabels("database"),
+		),
+		lag: metrics.Gauge(
+			"db_outbox_lag_seconds",
+			metricsx.WithHelp("Age of the oldest undelivered outbox message in seconds"),
+			metricsx.WithLabels("database"),
+		),
+	}
+}
+
+func (m *outboxMetrics) published(dbName string, n int) {
+	if m == nil {
+		return
+	}
+	m.publishedTotal.Add(float64(n), dbName)
+}
+
+func (m *outboxMetrics) failed(dbName string, n int) {
+	if m == nil {
+		return
+	}
+	m.failuresTotal.Add(float64(n), dbName)
+}
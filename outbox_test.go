@@ -0,0 +1,196 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// recordingPublisher captures published batches and optionally fails
+type recordingPublisher struct {
+	batches [][]OutboxMessage
+	err     error
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, msgs []OutboxMessage) error {
+	p.batches = append(p.batches, msgs)
+	return p.err
+}
+
+func setupOutboxDB(t *testing.T) *gorm.DB {
+	db := setupTestDB(t)
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+	require.NoError(t, EnsureOutboxTable(context.Background(), db, defaultOutboxTable))
+	return db
+}
+
+func TestOutboxEnqueue(t *testing.T) {
+	db := setupOutboxDB(t)
+	outbox := NewOutbox("primary", DefaultOutboxConfig())
+	ctx := context.Background()
+
+	t.Run("requires transaction", func(t *testing.T) {
+		err := outbox.Enqueue(ctx, db, OutboxMessage{Topic: "users", Payload: []byte("{}")})
+		assert.ErrorIs(t, err, ErrOutboxNotInTransaction)
+	})
+
+	t.Run("requires topic", func(t *testing.T) {
+		err := WithTxContext(ctx, db, func(ctx context.Context, tx *gorm.DB) error {
+			return outbox.Enqueue(ctx, tx, OutboxMessage{Payload: []byte("{}")})
+		})
+		assert.ErrorIs(t, err, ErrOutboxTopicRequired)
+	})
+
+	t.Run("rolled back with transaction", func(t *testing.T) {
+		testErr := errors.New("business failure")
+		err := WithTxContext(ctx, db, func(ctx context.Context, tx *gorm.DB) error {
+			if err := outbox.Enqueue(ctx, tx, OutboxMessage{Topic: "users", Payload: []byte("{}")}); err != nil {
+				return err
+			}
+			return testErr
+		})
+		assert.Equal(t, testErr, err)
+
+		var count int64
+		db.Table(defaultOutboxTable).Count(&count)
+		assert.Equal(t, int64(0), count)
+	})
+
+	t.Run("committed with transaction", func(t *testing.T) {
+		err := WithTxContext(ctx, db, func(ctx context.Context, tx *gorm.DB) error {
+			return outbox.Enqueue(ctx, tx,
+				OutboxMessage{Topic: "users", Key: "1", Payload: []byte(`{"id":1}`), Headers: map[string]string{"type": "created"}},
+				OutboxMessage{Topic: "users", Key: "2", Payload: []byte(`{"id":2}`)},
+			)
+		})
+		require.NoError(t, err)
+
+		var msgs []OutboxMessage
+		require.NoError(t, db.Table(defaultOutboxTable).Order("id").Find(&msgs).Error)
+		require.Len(t, msgs, 2)
+		assert.Equal(t, "1", msgs[0].Key)
+		assert.Equal(t, "created", msgs[0].Headers["type"])
+		assert.Nil(t, msgs[0].DeliveredAt)
+	})
+}
+
+func TestOutboxRelay(t *testing.T) {
+	ctx := context.Background()
+
+	enqueue := func(t *testing.T, db *gorm.DB, n int) {
+		outbox := NewOutbox("primary", DefaultOutboxConfig())
+		msgs := make([]OutboxMessage, n)
+		for i := range msgs {
+			msgs[i] = OutboxMessage{Topic: "orders", Payload: []byte("{}")}
+		}
+		require.NoError(t, WithTxContext(ctx, db, func(ctx context.Context, tx *gorm.DB) error {
+			return outbox.Enqueue(ctx, tx, msgs...)
+		}))
+	}
+
+	t.Run("delivers batch", func(t *testing.T) {
+		db := setupOutboxDB(t)
+		enqueue(t, db, 3)
+
+		publisher := &recordingPublisher{}
+		cfg := DefaultOutboxConfig()
+		cfg.BatchSize = 2
+		relay := NewOutboxRelay("primary", db, cfg, publisher, &testLogger{}, nil)
+
+		n, err := relay.RelayOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 2, n)
+
+		n, err = relay.RelayOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 1, n)
+
+		n, err = relay.RelayOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+		assert.Len(t, publisher.batches, 2)
+
+		backlog, _, err := relay.Backlog(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), backlog)
+	})
+
+	t.Run("schedules retry on failure", func(t *testing.T) {
+		db := setupOutboxDB(t)
+		enqueue(t, db, 1)
+
+		publisher := &recordingPublisher{err: errors.New("broker down")}
+		relay := NewOutboxRelay("primary", db, DefaultOutboxConfig(), publisher, &testLogger{}, nil)
+
+		n, err := relay.RelayOnce(ctx)
+		assert.Error(t, err)
+		assert.Equal(t, 1, n)
+
+		var msg OutboxMessage
+		require.NoError(t, db.Table(defaultOutboxTable).First(&msg).Error)
+		assert.Equal(t, 1, msg.Attempts)
+		assert.Equal(t, "broker down", msg.LastError)
+		assert.True(t, msg.AvailableAt.After(time.Now().UTC()))
+
+		// Not eligible again until the backoff elapses
+		n, err = relay.RelayOnce(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, 0, n)
+
+		backlog, oldest, err := relay.Backlog(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), backlog)
+		assert.False(t, oldest.IsZero())
+	})
+}
+
+func TestOutboxRelayPurge(t *testing.T) {
+	ctx := context.Background()
+	db := setupOutboxDB(t)
+
+	outbox := NewOutbox("primary", DefaultOutboxConfig())
+	require.NoError(t, WithTxContext(ctx, db, func(ctx context.Context, tx *gorm.DB) error {
+		return outbox.Enqueue(ctx, tx,
+			OutboxMessage{Topic: "orders", Payload: []byte("{}")},
+			OutboxMessage{Topic: "orders", Payload: []byte("{}")},
+			OutboxMessage{Topic: "orders", Payload: []byte("{}")},
+		)
+	}))
+
+	cfg := DefaultOutboxConfig()
+	cfg.BatchSize = 2
+	cfg.Retention = time.Hour
+	relay := NewOutboxRelay("primary", db, cfg, &recordingPublisher{}, &testLogger{}, nil)
+
+	n, err := relay.RelayOnce(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 2, n)
+
+	// Only messages delivered before the retention period are deleted
+	deleted, err := relay.Purge(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, deleted)
+
+	require.NoError(t, db.Table(defaultOutboxTable).Where("id = ?", 1).
+		Update("delivered_at", time.Now().UTC().Add(-2*time.Hour)).Error)
+	deleted, err = relay.Purge(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), deleted)
+
+	var ids []uint64
+	require.NoError(t, db.Table(defaultOutboxTable).Order("id").Pluck("id", &ids).Error)
+	assert.Equal(t, []uint64{2, 3}, ids, "recent and undelivered messages are kept")
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	assert.Equal(t, time.Second, outboxBackoff(1, time.Second, time.Minute))
+	assert.Equal(t, 4*time.Second, outboxBackoff(3, time.Second, time.Minute))
+	assert.Equal(t, time.Minute, outboxBackoff(20, time.Second, time.Minute))
+}
@@ -0,0 +1,166 @@
+package dbx
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gostratum/core/logx"
+	"github.com/gostratum/metricsx"
+)
+
+// defaultQueryEventBuffer is the buffer size used when none is given
+const defaultQueryEventBuffer = 1024
+
+// QueryEvent describes a finished database operation
+type QueryEvent struct {
+	Database string
+	// Role is "primary" or "replica", the connection the operation ran on
+	Role        string
+	Table       string
+	Operation   string
+	Fingerprint string
+	// SQL is the statement normalized like Fingerprint, without literal values
+	SQL          string
+	Start        time.Time
+	Duration     time.Duration
+	RowsAffected int64
+	// Err is the operation's error, including gorm.ErrRecordNotFound
+	Err error
+	// ErrorType is the ClassifyError class of Err, empty for no error or
+	// gorm.ErrRecordNotFound
+	ErrorType string
+	// Fields are extracted from the statement's context (see WithEventContextFields)
+	Fields []logx.Field
+}
+
+// QuerySubscriber receives query events from a MetricsPlugin. Events are
+// delivered in order from a dedicated goroutine per subscriber and plugin;
+// a subscriber registered on several databases is called concurrently.
+type QuerySubscriber interface {
+	HandleQueryEvent(event QueryEvent)
+}
+
+// QuerySubscriberFunc adapts a function to QuerySubscriber
+type QuerySubscriberFunc func(event QueryEvent)
+
+// HandleQueryEvent calls f(event)
+func (f QuerySubscriberFunc) HandleQueryEvent(event QueryEvent) {
+	f(event)
+}
+
+// WithQuerySubscriber delivers an event per operation to subscriber. Events
+// are buffered (defaultQueryEventBuffer when buffer <= 0) and dropped when
+// the buffer is full, so a slow subscriber never delays queries. Drops are
+// counted in db_query_events_dropped_total and by DroppedEvents.
+func WithQuerySubscriber(name string, subscriber QuerySubscriber, buffer int) MetricsOption {
+	return func(p *MetricsPlugin) {
+		if buffer <= 0 {
+			buffer = defaultQueryEventBuffer
+		}
+		p.subscriptions = append(p.subscriptions, &querySubscription{
+			name:       name,
+			subscriber: subscriber,
+			buffer:     buffer,
+		})
+	}
+}
+
+// WithEventContextFields adds extractors for the Fields of query events.
+// OpenTelemetry trace_id and span_id are always extracted.
+func WithEventContextFields(extractors ...ContextFieldExtractor) MetricsOption {
+	return func(p *MetricsPlugin) {
+		p.eventFields = append(p.eventFields, extractors...)
+	}
+}
+
+// querySubscription is a subscriber with its buffer
+type querySubscription struct {
+	name       string
+	subscriber QuerySubscriber
+	buffer     int
+	events     chan QueryEvent
+	dropped    atomic.Uint64
+}
+
+// queryEvents dispatches events to the plugin's subscriptions
+type queryEvents struct {
+	mu      sync.RWMutex
+	closed  bool
+	wg      sync.WaitGroup
+	dropped metricsx.Counter
+}
+
+// startSubscriptions starts a delivery goroutine per subscription
+func (p *MetricsPlugin) startSubscriptions() {
+	p.events.dropped = p.metrics.Counter(
+		"db_query_events_dropped_total",
+		metricsx.WithHelp("Total number of query events dropped because a subscriber's buffer was full"),
+		metricsx.WithLabels("database", "subscriber"),
+	)
+	for _, s := range p.subscriptions {
+		s.events = make(chan QueryEvent, s.buffer)
+		p.events.wg.Add(1)
+		go func(s *querySubscription) {
+			defer p.events.wg.Done()
+			for event := range s.events {
+				s.subscriber.HandleQueryEvent(event)
+			}
+		}(s)
+	}
+}
+
+// publish hands the event to every subscription without blocking
+func (p *MetricsPlugin) publish(event QueryEvent) {
+	p.events.mu.RLock()
+	defer p.events.mu.RUnlock()
+	if p.events.closed {
+		return
+	}
+	for _, s := range p.subscriptions {
+		select {
+		case s.events <- event:
+		default:
+			s.dropped.Add(1)
+			p.events.dropped.Inc(event.Database, s.name)
+		}
+	}
+}
+
+// eventContextFields extracts the context fields of an event
+func (p *MetricsPlugin) eventContextFields(ctx context.Context) []logx.Field {
+	if ctx == nil {
+		return nil
+	}
+	var fields []logx.Field
+	for _, extract := range p.eventFields {
+		fields = append(fields, extract(ctx)...)
+	}
+	return fields
+}
+
+// DroppedEvents returns the number of events dropped per subscriber
+func (p *MetricsPlugin) DroppedEvents() map[string]uint64 {
+	out := make(map[string]uint64, len(p.subscriptions))
+	for _, s := range p.subscriptions {
+		out[s.name] += s.dropped.Load()
+	}
+	return out
+}
+
+// Close stops event delivery and waits for subscribers to handle the
+// events already buffered
+func (p *MetricsPlugin) Close() {
+	p.events.mu.Lock()
+	if p.events.closed {
+		p.events.mu.Unlock()
+		return
+	}
+	p.events.closed = true
+	for _, s := range p.subscriptions {
+		close(s.events)
+	}
+	p.events.mu.Unlock()
+	p.events.wg.Wait()
+}
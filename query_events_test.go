@@ -0,0 +1,90 @@
+package dbx
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gostratum/core/logx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSubscriber struct {
+	mu     sync.Mutex
+	events []QueryEvent
+}
+
+func (s *recordingSubscriber) HandleQueryEvent(event QueryEvent) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, event)
+}
+
+func TestQuerySubscriber(t *testing.T) {
+	db := setupTestDB(t)
+	require.NoError(t, db.Exec("CREATE TABLE test_users (id INTEGER PRIMARY KEY, name TEXT)").Error)
+
+	subscriber := &recordingSubscriber{}
+	plugin := NewMetricsPlugin(newMockMetrics(),
+		WithQuerySubscriber("costs", subscriber, 0),
+		WithEventContextFields(ContextValueField("tenant", tenantKey{})),
+	)
+	require.NoError(t, db.Use(plugin))
+
+	ctx := context.WithValue(context.Background(), tenantKey{}, "acme")
+	require.NoError(t, db.WithContext(ctx).Exec("INSERT INTO test_users (name) VALUES (?)", "alice").Error)
+	var count int64
+	require.NoError(t, db.WithContext(ctx).Table("test_users").Where("name = ?", "alice").Count(&count).Error)
+	assert.Error(t, db.Exec("SELECT * FROM missing").Error)
+	plugin.Close()
+
+	require.Len(t, subscriber.events, 3)
+	insert, query, failed := subscriber.events[0], subscriber.events[1], subscriber.events[2]
+
+	assert.Equal(t, "raw", insert.Operation)
+	assert.Equal(t, int64(1), insert.RowsAffected)
+	assert.Equal(t, "INSERT INTO test_users (name) VALUES (...)", insert.SQL)
+
+	assert.Equal(t, "select", query.Operation)
+	assert.Equal(t, "test_users", query.Table)
+	_, hash := Fingerprint("SELECT count(*) FROM `test_users` WHERE name = ?")
+	assert.Equal(t, hash, query.Fingerprint)
+	assert.False(t, query.Start.IsZero())
+	assert.Contains(t, query.Fields, logx.String("tenant", "acme"))
+
+	assert.Error(t, failed.Err)
+	assert.Empty(t, failed.Fields)
+}
+
+func TestQuerySubscriber_DropsWhenFull(t *testing.T) {
+	db := setupTestDB(t)
+	metrics := newMockMetrics()
+
+	release := make(chan struct{})
+	handled := make(chan struct{}, 10)
+	blocking := QuerySubscriberFunc(func(QueryEvent) {
+		<-release
+		handled <- struct{}{}
+	})
+	plugin := NewMetricsPlugin(metrics, WithQuerySubscriber("slow", blocking, 1))
+	require.NoError(t, db.Use(plugin))
+
+	// The first event is being handled, the second is buffered, the rest are dropped
+	require.NoError(t, db.Exec("SELECT 1").Error)
+	require.Eventually(t, func() bool { return len(plugin.subscriptions[0].events) == 0 }, time.Second, time.Millisecond)
+	for i := 0; i < 4; i++ {
+		require.NoError(t, db.Exec("SELECT 1").Error)
+	}
+
+	assert.Equal(t, map[string]uint64{"slow": 3}, plugin.DroppedEvents())
+	assert.Equal(t, float64(3), metrics.counter("db_query_events_dropped_total", "default", "slow"))
+
+	close(release)
+	plugin.Close()
+	assert.Len(t, handled, 2)
+
+	// Events after Close are discarded
+	require.NoError(t, db.Exec("SELECT 1").Error)
+}
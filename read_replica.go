@@ -1,6 +1,7 @@
 package dbx
 
 import (
+	"database/sql"
 	"fmt"
 
 	"github.com/gostratum/core/logx"
@@ -27,10 +28,17 @@ func configureReadReplicas(db *gorm.DB, replicas []string, logger logx.Logger) e
 		logx.Int("count", len(replicas)),
 	)
 
-	// Create replica dialectors
+	// Open replica pools ourselves so they can be inspected and closed later
+	set := &replicaSet{pools: make([]*sql.DB, 0, len(replicas))}
 	replicaDialectors := make([]gorm.Dialector, len(replicas))
 	for i, dsn := range replicas {
-		replicaDialectors[i] = postgres.Open(dsn)
+		pool, err := sql.Open("pgx", dsn)
+		if err != nil {
+			set.close()
+			return fmt.Errorf("failed to open read replica %d: %w", i, err)
+		}
+		set.pools = append(set.pools, pool)
+		replicaDialectors[i] = postgres.New(postgres.Config{Conn: pool})
 		logger.Debug("Added read replica",
 			logx.Int("index", i),
 			logx.String("dsn", sanitizeDSN(dsn)),
@@ -50,9 +58,15 @@ func configureReadReplicas(db *gorm.DB, replicas []string, logger logx.Logger) e
 		SetMaxOpenConns(DefaultDatabaseConfig().MaxOpenConns))
 
 	if err != nil {
+		set.close()
 		return fmt.Errorf("failed to register read replicas: %w", err)
 	}
 
+	if err := db.Use(set); err != nil {
+		set.close()
+		return fmt.Errorf("failed to track read replicas: %w", err)
+	}
+
 	logger.Info("Read replicas configured successfully",
 		logx.Int("replicas", len(replicas)),
 	)
@@ -60,6 +74,76 @@ func configureReadReplicas(db *gorm.DB, replicas []string, logger logx.Logger) e
 	return nil
 }
 
+const replicaSetName = "dbx:replicas"
+
+// replicaSet keeps the read replica pools of a database
+type replicaSet struct {
+	pools []*sql.DB
+}
+
+// Name returns the plugin name
+func (s *replicaSet) Name() string {
+	return replicaSetName
+}
+
+// Initialize implements gorm.Plugin interface
+func (s *replicaSet) Initialize(db *gorm.DB) error {
+	return nil
+}
+
+// close closes every replica pool
+func (s *replicaSet) close() error {
+	var firstErr error
+	for _, pool := range s.pools {
+		if err := pool.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// replicaPools returns the read replica pools configured on db
+func replicaPools(db *gorm.DB) []*sql.DB {
+	if db == nil || db.Config == nil {
+		return nil
+	}
+	if s, ok := db.Config.Plugins[replicaSetName].(*replicaSet); ok {
+		return s.pools
+	}
+	return nil
+}
+
+// Connection roles used in metric labels
+const (
+	rolePrimary = "primary"
+	roleReplica = "replica"
+)
+
+// connectionRole reports whether the statement of db ran on a read replica
+func connectionRole(db *gorm.DB) string {
+	pool := db.Statement.ConnPool
+	if prepared, ok := pool.(*gorm.PreparedStmtDB); ok {
+		pool = prepared.ConnPool
+	}
+	for _, replica := range replicaPools(db) {
+		if pool == gorm.ConnPool(replica) {
+			return roleReplica
+		}
+	}
+	return rolePrimary
+}
+
+// closeReplicas closes the read replica pools configured on db
+func closeReplicas(db *gorm.DB) error {
+	if db == nil || db.Config == nil {
+		return nil
+	}
+	if s, ok := db.Config.Plugins[replicaSetName].(*replicaSet); ok {
+		return s.close()
+	}
+	return nil
+}
+
 // sanitizeDSN removes sensitive information from DSN for logging
 func sanitizeDSN(dsn string) string {
 	// Simple sanitization - in production use proper URL parsing
@@ -0,0 +1,96 @@
+package dbx
+
+import (
+	"database/sql"
+	"fmt"
+	"sync"
+
+	"gorm.io/gorm"
+)
+
+// connectionState is the state dbx keeps for a connection created by the
+// module. Fields are nil when the connection does not use them.
+type connectionState struct {
+	// tx holds transaction defaults and tracks open transactions
+	tx *txState
+	// server holds the server version detected at startup
+	server *serverInfo
+	// migration shares the migration status reader of a Postgres database
+	migration *migrationStatus
+}
+
+// connectionRegistry holds the state of each connection keyed by connection
+// name, like Connections. Handles derived from a connection (sessions,
+// transactions, prepared statements) are resolved through their pool.
+type connectionRegistry struct {
+	mu     sync.RWMutex
+	states map[string]*connectionState
+	pools  map[*sql.DB]string
+}
+
+// connectionStates is the registry of the connections created by dbx
+var connectionStates = &connectionRegistry{
+	states: make(map[string]*connectionState),
+	pools:  make(map[*sql.DB]string),
+}
+
+// register stores the state of the named connection, replacing the state of
+// a previous connection with the same name
+func (r *connectionRegistry) register(name string, db *gorm.DB, state *connectionState) error {
+	pool, err := db.DB()
+	if err != nil {
+		return fmt.Errorf("failed to get underlying sql.DB: %w", err)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for p, n := range r.pools {
+		if n == name {
+			delete(r.pools, p)
+		}
+	}
+	r.states[name] = state
+	r.pools[pool] = name
+	return nil
+}
+
+// unregister removes the state of the named connection if db still owns it
+func (r *connectionRegistry) unregister(name string, db *gorm.DB) {
+	pool, err := db.DB()
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pools[pool] != name {
+		return
+	}
+	delete(r.pools, pool)
+	delete(r.states, name)
+}
+
+// lookup returns the state of the connection db belongs to, if any
+func (r *connectionRegistry) lookup(db *gorm.DB) *connectionState {
+	if db == nil || db.Config == nil {
+		return nil
+	}
+	pool, err := db.DB()
+	if err != nil {
+		return nil
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	name, ok := r.pools[pool]
+	if !ok {
+		return nil
+	}
+	return r.states[name]
+}
+
+// connectionStateFor returns the registered state of the connection db
+// belongs to, or nil for connections created outside the module
+func connectionStateFor(db *gorm.DB) *connectionState {
+	return connectionStates.lookup(db)
+}
@@ -0,0 +1,57 @@
+package dbx
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// registerState registers the state of a connection for the duration of the test
+func registerState(t *testing.T, name string, db *gorm.DB, state *connectionState) {
+	t.Helper()
+	require.NoError(t, connectionStates.register(name, db, state))
+	t.Cleanup(func() { connectionStates.unregister(name, db) })
+}
+
+func TestConnectionRegistry(t *testing.T) {
+	db := setupTestDB(t)
+	state := &connectionState{tx: newTxState("primary", &DatabaseConfig{}, &testLogger{})}
+	registerState(t, "primary", db, state)
+
+	// Handles derived from the connection share its state
+	assert.Same(t, state, connectionStateFor(db))
+	assert.Same(t, state, connectionStateFor(db.Session(&gorm.Session{NewDB: true})))
+	assert.Same(t, state, connectionStateFor(db.Session(&gorm.Session{PrepareStmt: true})))
+	require.NoError(t, WithTx(db, func(tx *gorm.DB) error {
+		assert.Same(t, state, connectionStateFor(tx))
+		return nil
+	}))
+
+	assert.Nil(t, connectionStateFor(setupTestDB(t)), "unregistered connection")
+	assert.Nil(t, connectionStateFor(nil))
+	assert.Nil(t, txStateFor(setupTestDB(t)))
+	assert.Nil(t, serverInfoFor(db), "state the connection does not use")
+}
+
+func TestConnectionRegistry_ReplaceAndUnregister(t *testing.T) {
+	registry := &connectionRegistry{states: make(map[string]*connectionState), pools: make(map[*sql.DB]string)}
+	first, second := setupTestDB(t), setupTestDB(t)
+	firstState, secondState := &connectionState{}, &connectionState{}
+
+	require.NoError(t, registry.register("primary", first, firstState))
+	require.NoError(t, registry.register("primary", second, secondState))
+	assert.Nil(t, registry.lookup(first), "a name identifies one connection")
+	assert.Same(t, secondState, registry.lookup(second))
+
+	// The replaced connection no longer owns the name
+	registry.unregister("primary", first)
+	assert.Same(t, secondState, registry.lookup(second))
+
+	registry.unregister("primary", second)
+	assert.Nil(t, registry.lookup(second))
+	assert.Empty(t, registry.states)
+	assert.Empty(t, registry.pools)
+}
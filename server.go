@@ -0,0 +1,152 @@
+package dbx
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/gostratum/core/logx"
+	"gorm.io/gorm"
+)
+
+// serverInfo holds the server version detected at startup
+type serverInfo struct {
+	mu         sync.RWMutex
+	version    string
+	versionNum int
+}
+
+// serverInfoFor returns the server info registered for db, if any
+func serverInfoFor(db *gorm.DB) *serverInfo {
+	if s := connectionStateFor(db); s != nil {
+		return s.server
+	}
+	return nil
+}
+
+// ServerVersion returns the server version detected when the module started,
+// or "" if it has not been detected
+func ServerVersion(db *gorm.DB) string {
+	s := serverInfoFor(db)
+	if s == nil {
+		return ""
+	}
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.version
+}
+
+// verifyServer detects the server version of a Postgres database and checks
+// it against min_server_version and required_extensions
+func verifyServer(ctx context.Context, name string, db *gorm.DB, dbCfg *DatabaseConfig, logger logx.Logger) error {
+	if db.Dialector.Name() != "postgres" {
+		return nil
+	}
+
+	var version string
+	var versionNum int
+	row := db.WithContext(ctx).Raw("SELECT current_setting('server_version'), current_setting('server_version_num')::int").Row()
+	if err := row.Scan(&version, &versionNum); err != nil {
+		return fmt.Errorf("failed to detect server version for %s: %w", name, err)
+	}
+
+	if s := serverInfoFor(db); s != nil {
+		s.mu.Lock()
+		s.version = version
+		s.versionNum = versionNum
+		s.mu.Unlock()
+	}
+
+	logger.Info("Detected database server version",
+		logx.String("database", name),
+		logx.String("server_version", version),
+	)
+
+	if dbCfg == nil {
+		return nil
+	}
+
+	if err := checkMinServerVersion(version, versionNum, dbCfg.MinServerVersion); err != nil {
+		return fmt.Errorf("database %s: %w", name, err)
+	}
+
+	if len(dbCfg.RequiredExtensions) > 0 {
+		var installed []string
+		if err := db.WithContext(ctx).Raw("SELECT extname FROM pg_extension").Scan(&installed).Error; err != nil {
+			return fmt.Errorf("failed to list extensions for %s: %w", name, err)
+		}
+		if err := checkRequiredExtensions(installed, dbCfg.RequiredExtensions); err != nil {
+			return fmt.Errorf("database %s: %w", name, err)
+		}
+	}
+
+	return nil
+}
+
+// checkMinServerVersion compares the detected server_version_num with the minimum
+func checkMinServerVersion(version string, versionNum int, minVersion string) error {
+	if minVersion == "" {
+		return nil
+	}
+
+	minNum, err := parseServerVersion(minVersion)
+	if err != nil {
+		return fmt.Errorf("invalid min_server_version: %w", err)
+	}
+
+	if versionNum < minNum {
+		return fmt.Errorf("server version %s is older than min_server_version %s", version, minVersion)
+	}
+	return nil
+}
+
+// checkRequiredExtensions reports the required extensions missing from installed
+func checkRequiredExtensions(installed, required []string) error {
+	have := make(map[string]bool, len(installed))
+	for _, ext := range installed {
+		have[strings.ToLower(ext)] = true
+	}
+
+	var missing []string
+	for _, ext := range required {
+		if !have[strings.ToLower(ext)] {
+			missing = append(missing, ext)
+		}
+	}
+
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return fmt.Errorf("missing required extensions: %s (install with CREATE EXTENSION)", strings.Join(missing, ", "))
+	}
+	return nil
+}
+
+// parseServerVersion converts a version such as "14", "14.5" or "9.6.24" into
+// the server_version_num format (140000, 140005, 90624)
+func parseServerVersion(v string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(v), ".")
+	if len(parts) == 0 || len(parts) > 3 {
+		return 0, fmt.Errorf("unrecognized version %q", v)
+	}
+
+	nums := make([]int, 3)
+	for i, p := range parts {
+		n, err := strconv.Atoi(p)
+		if err != nil || n < 0 {
+			return 0, fmt.Errorf("unrecognized version %q", v)
+		}
+		nums[i] = n
+	}
+
+	// Since Postgres 10 the version has two parts: major.minor
+	if nums[0] >= 10 {
+		if len(parts) > 2 {
+			return 0, fmt.Errorf("unrecognized version %q", v)
+		}
+		return nums[0]*10000 + nums[1], nil
+	}
+	return nums[0]*10000 + nums[1]*100 + nums[2], nil
+}
@@ -0,0 +1,89 @@
+package dbx
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseServerVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		want    int
+		wantErr bool
+	}{
+		{version: "14", want: 140000},
+		{version: "14.5", want: 140005},
+		{version: "16.10", want: 160010},
+		{version: "9.6", want: 90600},
+		{version: "9.6.24", want: 90624},
+		{version: " 15 ", want: 150000},
+		{version: "14.5.1", wantErr: true},
+		{version: "fourteen", wantErr: true},
+		{version: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.version, func(t *testing.T) {
+			got, err := parseServerVersion(tt.version)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCheckMinServerVersion(t *testing.T) {
+	assert.NoError(t, checkMinServerVersion("15.4", 150004, ""))
+	assert.NoError(t, checkMinServerVersion("15.4", 150004, "14"))
+	assert.NoError(t, checkMinServerVersion("15.4", 150004, "15.4"))
+
+	err := checkMinServerVersion("13.12", 130012, "14")
+	require.Error(t, err)
+	assert.Equal(t, "server version 13.12 is older than min_server_version 14", err.Error())
+}
+
+func TestCheckRequiredExtensions(t *testing.T) {
+	installed := []string{"plpgsql", "pgcrypto"}
+
+	assert.NoError(t, checkRequiredExtensions(installed, nil))
+	assert.NoError(t, checkRequiredExtensions(installed, []string{"PGCRYPTO"}))
+
+	err := checkRequiredExtensions(installed, []string{"pgcrypto", "postgis", "pg_trgm"})
+	require.Error(t, err)
+	assert.Equal(t, "missing required extensions: pg_trgm, postgis (install with CREATE EXTENSION)", err.Error())
+}
+
+func TestVerifyServer_NonPostgres(t *testing.T) {
+	db := setupTestDB(t)
+	registerState(t, "primary", db, &connectionState{server: &serverInfo{}})
+
+	err := verifyServer(context.Background(), "primary", db, &DatabaseConfig{}, &testLogger{})
+	assert.NoError(t, err)
+	assert.Empty(t, ServerVersion(db))
+}
+
+func TestServerVersionInConnectionStats(t *testing.T) {
+	db := setupTestDB(t)
+	registerState(t, "primary", db, &connectionState{server: &serverInfo{version: "16.2", versionNum: 160002}})
+
+	stats, err := NewHealthChecker(Connections{"primary": db}, nil).GetConnectionStats()
+	require.NoError(t, err)
+	assert.Equal(t, "16.2", stats["primary"].ServerVersion)
+}
+
+func TestServerRequirementsValidation(t *testing.T) {
+	cfg := &DatabaseConfig{Driver: "sqlite", DSN: ":memory:", RequiredExtensions: []string{"pgcrypto"}}
+	assert.ErrorContains(t, cfg.Validate(), "only supported for postgres")
+
+	cfg = &DatabaseConfig{Driver: "postgres", DSN: "postgres://localhost/app", MinServerVersion: "latest"}
+	assert.ErrorContains(t, cfg.Validate(), "invalid min_server_version")
+
+	cfg = &DatabaseConfig{Driver: "postgres", DSN: "postgres://localhost/app", MinServerVersion: "14", RequiredExtensions: []string{"pgcrypto"}}
+	assert.NoError(t, cfg.Validate())
+}
@@ -0,0 +1,159 @@
+package dbx
+
+import (
+	"context"
+	"net/url"
+	"slices"
+	"sort"
+	"strings"
+
+	"go.opentelemetry.io/otel/propagation"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	sqlCommentPluginName = "dbx:sql_comment"
+	sqlCommentClause     = "dbx:sql_comment"
+)
+
+// sqlCommentTagsKey is the context key of the tags added by WithSQLCommentTags
+type sqlCommentTagsKey struct{}
+
+// WithSQLCommentTags adds tags, such as route or controller, to the SQL
+// comment of statements run with the returned context. Tags of the parent
+// context are kept unless overridden.
+func WithSQLCommentTags(ctx context.Context, tags map[string]string) context.Context {
+	merged := make(map[string]string, len(tags))
+	if parent, ok := ctx.Value(sqlCommentTagsKey{}).(map[string]string); ok {
+		for k, v := range parent {
+			merged[k] = v
+		}
+	}
+	for k, v := range tags {
+		merged[k] = v
+	}
+	return context.WithValue(ctx, sqlCommentTagsKey{}, merged)
+}
+
+// sqlCommenter appends a SQLCommenter-style comment to every statement:
+//
+//	SELECT * FROM users /*application='billing',database='primary',route='%2Fusers'*/
+//
+// Keys are sorted and values URL-encoded, so comments cannot be closed early.
+type sqlCommenter struct {
+	tags        map[string]string
+	traceparent bool
+}
+
+func newSQLCommenter(database string, cfg SQLCommentConfig) *sqlCommenter {
+	tags := map[string]string{"database": database}
+	if cfg.Application != "" {
+		tags["application"] = cfg.Application
+	}
+	return &sqlCommenter{tags: tags, traceparent: cfg.Traceparent}
+}
+
+// Name returns the plugin name
+func (c *sqlCommenter) Name() string {
+	return sqlCommentPluginName
+}
+
+// Initialize implements gorm.Plugin interface. It is registered after the
+// tracing plugin so the comment carries the statement's own span.
+func (c *sqlCommenter) Initialize(db *gorm.DB) error {
+	cb := db.Callback()
+
+	if err := cb.Create().Before("gorm:create").Register(sqlCommentPluginName, c.before); err != nil {
+		return err
+	}
+	if err := cb.Query().Before("gorm:query").Register(sqlCommentPluginName, c.before); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register(sqlCommentPluginName, c.before); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register(sqlCommentPluginName, c.before); err != nil {
+		return err
+	}
+	if err := cb.Raw().Before("gorm:raw").Register(sqlCommentPluginName, c.before); err != nil {
+		return err
+	}
+	return cb.Row().Before("gorm:row").Register(sqlCommentPluginName, c.before)
+}
+
+// before appends the comment to statements whose SQL is already set (raw
+// SQL) and adds a trailing clause to those gorm is about to build
+func (c *sqlCommenter) before(tx *gorm.DB) {
+	stmt := tx.Statement
+	if stmt.SQL.Len() > 0 {
+		stmt.SQL.WriteByte(' ')
+		stmt.SQL.WriteString(c.comment(stmt.Context))
+		return
+	}
+
+	if stmt.Clauses == nil {
+		stmt.Clauses = make(map[string]clause.Clause)
+	}
+	stmt.Clauses[sqlCommentClause] = clause.Clause{Name: sqlCommentClause, Builder: c.build}
+	if !slices.Contains(stmt.BuildClauses, sqlCommentClause) {
+		stmt.BuildClauses = append(slices.Clip(stmt.BuildClauses), sqlCommentClause)
+	}
+}
+
+// build writes the comment when gorm builds the statement
+func (c *sqlCommenter) build(_ clause.Clause, builder clause.Builder) {
+	ctx := context.Background()
+	if stmt, ok := builder.(*gorm.Statement); ok && stmt.Context != nil {
+		ctx = stmt.Context
+	}
+	builder.WriteString(c.comment(ctx))
+}
+
+// comment formats the tags of the database, the context and the current span
+func (c *sqlCommenter) comment(ctx context.Context) string {
+	tags := make(map[string]string, len(c.tags)+4)
+	if extra, ok := ctx.Value(sqlCommentTagsKey{}).(map[string]string); ok {
+		for k, v := range extra {
+			if v != "" {
+				tags[k] = v
+			}
+		}
+	}
+	for k, v := range c.tags {
+		tags[k] = v
+	}
+	if c.traceparent {
+		carrier := propagation.MapCarrier{}
+		propagation.TraceContext{}.Inject(ctx, carrier)
+		for k, v := range carrier {
+			tags[k] = v
+		}
+	}
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString("/*")
+	for i, k := range keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(sqlCommentEscape(k))
+		b.WriteString("='")
+		b.WriteString(sqlCommentEscape(tags[k]))
+		b.WriteByte('\'')
+	}
+	b.WriteString("*/")
+	return b.String()
+}
+
+// sqlCommentEscape URL-encodes a key or value as SQLCommenter requires: spaces
+// become %20 rather than +, and quotes and comment delimiters are escaped
+func sqlCommentEscape(s string) string {
+	return strings.ReplaceAll(url.QueryEscape(s), "+", "%20")
+}
@@ -0,0 +1,117 @@
+package dbx
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+// setupCommentedDB returns a database tagging statements and a func listing
+// the statements executed so far
+func setupCommentedDB(t *testing.T, cfg SQLCommentConfig, plugins ...gorm.Plugin) (*gorm.DB, func() []string) {
+	logger := newRecordingLogger()
+	db, err := gorm.Open(sqlite.Open(":memory:"), &gorm.Config{Logger: NewGormLogger(logger, "info", time.Second)})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&tracedUser{}))
+	for _, p := range plugins {
+		require.NoError(t, db.Use(p))
+	}
+	require.NoError(t, db.Use(newSQLCommenter("primary", cfg)))
+
+	skip := len(logger.find("SQL query executed"))
+	return db, func() []string {
+		var out []string
+		for _, e := range logger.find("SQL query executed")[skip:] {
+			out = append(out, e.fields["sql"].(string))
+		}
+		return out
+	}
+}
+
+func TestSQLComment(t *testing.T) {
+	db, statements := setupCommentedDB(t, SQLCommentConfig{Enabled: true, Application: "billing"})
+
+	ctx := WithSQLCommentTags(context.Background(), map[string]string{"route": "/users/{id}", "controller": "users"})
+	require.NoError(t, db.WithContext(ctx).Create(&tracedUser{Name: "alice"}).Error)
+	var user tracedUser
+	require.NoError(t, db.WithContext(ctx).Where("name = ?", "alice").First(&user).Error)
+	require.NoError(t, db.WithContext(ctx).Model(&user).Update("name", "bob").Error)
+	require.NoError(t, db.WithContext(ctx).Exec("DELETE FROM traced_users WHERE name = ?", "bob").Error)
+
+	comment := "/*application='billing',controller='users',database='primary',route='%2Fusers%2F%7Bid%7D'*/"
+	got := statements()
+	require.Len(t, got, 4)
+	for _, sql := range got {
+		assert.True(t, strings.HasSuffix(sql, " "+comment), sql)
+	}
+	assert.Equal(t, 1, strings.Count(got[1], "/*"))
+}
+
+func TestSQLCommentEscape(t *testing.T) {
+	assert.Equal(t, "list%20users", sqlCommentEscape("list users"))
+	assert.Equal(t, "a%2Bb", sqlCommentEscape("a+b"))
+	assert.Equal(t, "it%27s%2A%2F", sqlCommentEscape("it's*/"))
+
+	db, statements := setupCommentedDB(t, SQLCommentConfig{Enabled: true})
+	ctx := WithSQLCommentTags(context.Background(), map[string]string{"action": "list users"})
+	require.NoError(t, db.WithContext(ctx).Exec("DELETE FROM traced_users").Error)
+
+	got := statements()
+	require.Len(t, got, 1)
+	assert.Contains(t, got[0], "action='list%20users'")
+}
+
+func TestSQLComment_RowAndRepeatedStatements(t *testing.T) {
+	db, statements := setupCommentedDB(t, SQLCommentConfig{Enabled: true})
+	require.NoError(t, db.Create(&tracedUser{Name: "alice"}).Error)
+
+	var count int64
+	require.NoError(t, db.Table("traced_users").Select("count(*)").Row().Scan(&count))
+	assert.Equal(t, int64(1), count)
+
+	// A reused statement is not tagged twice
+	query := db.Model(&tracedUser{}).Where("name = ?", "alice")
+	var users []tracedUser
+	require.NoError(t, query.Find(&users).Error)
+	require.NoError(t, query.Find(&users).Error)
+
+	for _, sql := range statements() {
+		assert.Equal(t, 1, strings.Count(sql, "/*database='primary'*/"), sql)
+	}
+}
+
+func TestSQLComment_Traceparent(t *testing.T) {
+	provider := sdktrace.NewTracerProvider()
+	db, statements := setupCommentedDB(t, SQLCommentConfig{Enabled: true, Traceparent: true},
+		NewTracingPlugin("primary", WithTracerProvider(provider)))
+
+	ctx, parent := provider.Tracer("test").Start(context.Background(), "handler")
+	var users []tracedUser
+	require.NoError(t, db.WithContext(ctx).Find(&users).Error)
+	parent.End()
+
+	got := statements()
+	require.Len(t, got, 1)
+	assert.Contains(t, got[0], "traceparent='00-"+parent.SpanContext().TraceID().String())
+	// The statement's own span is the parent, not the handler's
+	assert.NotContains(t, got[0], parent.SpanContext().SpanID().String())
+}
+
+func TestSQLComment_Validation(t *testing.T) {
+	cfg := DefaultDatabaseConfig()
+	cfg.DSN = "postgres://localhost/testdb"
+	cfg.SQLComment = SQLCommentConfig{Enabled: true, Traceparent: true}
+	err := cfg.Validate()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "sql_comment.traceparent")
+
+	cfg.PrepareStmt = false
+	assert.NoError(t, cfg.Validate())
+}
@@ -0,0 +1,215 @@
+package dbx
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.24.0"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+)
+
+const (
+	tracingPluginName = "dbx:tracing"
+	tracingSpanKey    = "dbx:span"
+	tracerName        = "github.com/gostratum/dbx"
+
+	// connectionAttribute names the dbx connection a span belongs to
+	connectionAttribute = attribute.Key("dbx.connection")
+)
+
+// TracingPlugin implements GORM plugin interface for OpenTelemetry tracing.
+// It creates a client span per create/query/update/delete/raw/row operation,
+// parented to the span in the statement's context, and a span per
+// transaction started through dbx.
+type TracingPlugin struct {
+	connection string
+	provider   trace.TracerProvider
+	tracer     trace.Tracer
+	statement  bool
+}
+
+// TracingOption configures a TracingPlugin
+type TracingOption func(*TracingPlugin)
+
+// WithTracerProvider sets the tracer provider (the global provider by default)
+func WithTracerProvider(provider trace.TracerProvider) TracingOption {
+	return func(p *TracingPlugin) {
+		p.provider = provider
+	}
+}
+
+// WithoutStatement omits the db.statement attribute from spans
+func WithoutStatement() TracingOption {
+	return func(p *TracingPlugin) {
+		p.statement = false
+	}
+}
+
+// NewTracingPlugin creates a tracing plugin for the named dbx connection
+func NewTracingPlugin(connection string, opts ...TracingOption) *TracingPlugin {
+	p := &TracingPlugin{connection: connection, statement: true}
+	for _, opt := range opts {
+		opt(p)
+	}
+	if p.provider == nil {
+		p.provider = otel.GetTracerProvider()
+	}
+	p.tracer = p.provider.Tracer(tracerName)
+	return p
+}
+
+// Name returns the plugin name
+func (p *TracingPlugin) Name() string {
+	return tracingPluginName
+}
+
+// Initialize implements gorm.Plugin interface
+func (p *TracingPlugin) Initialize(db *gorm.DB) error {
+	if err := p.registerCallbacks(db); err != nil {
+		return err
+	}
+
+	// Trace transactions started through dbx
+	txStateFor(db).setTracer(p.tracer, p.baseAttributes(db))
+	return nil
+}
+
+// registerCallbacks registers GORM callbacks for tracing
+func (p *TracingPlugin) registerCallbacks(db *gorm.DB) error {
+	cb := db.Callback()
+
+	if err := cb.Create().Before("gorm:create").Register(tracingPluginName+":before", p.before(db, "INSERT")); err != nil {
+		return err
+	}
+	if err := cb.Create().After("gorm:after_create").Register(tracingPluginName+":after", p.after); err != nil {
+		return err
+	}
+
+	if err := cb.Query().Before("gorm:query").Register(tracingPluginName+":before", p.before(db, "SELECT")); err != nil {
+		return err
+	}
+	if err := cb.Query().After("gorm:after_query").Register(tracingPluginName+":after", p.after); err != nil {
+		return err
+	}
+
+	if err := cb.Update().Before("gorm:update").Register(tracingPluginName+":before", p.before(db, "UPDATE")); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:after_update").Register(tracingPluginName+":after", p.after); err != nil {
+		return err
+	}
+
+	if err := cb.Delete().Before("gorm:delete").Register(tracingPluginName+":before", p.before(db, "DELETE")); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:after_delete").Register(tracingPluginName+":after", p.after); err != nil {
+		return err
+	}
+
+	if err := cb.Raw().Before("gorm:raw").Register(tracingPluginName+":before", p.before(db, "")); err != nil {
+		return err
+	}
+	if err := cb.Raw().After("gorm:after_raw").Register(tracingPluginName+":after", p.after); err != nil {
+		return err
+	}
+
+	if err := cb.Row().Before("gorm:row").Register(tracingPluginName+":before", p.before(db, "")); err != nil {
+		return err
+	}
+	return cb.Row().After("gorm:after_row").Register(tracingPluginName+":after", p.after)
+}
+
+// baseAttributes returns the attributes shared by every span of the database
+func (p *TracingPlugin) baseAttributes(db *gorm.DB) []attribute.KeyValue {
+	system := semconv.DBSystemOtherSQL
+	switch db.Dialector.Name() {
+	case "postgres":
+		system = semconv.DBSystemPostgreSQL
+	case "sqlite":
+		system = semconv.DBSystemSqlite
+	}
+
+	attrs := []attribute.KeyValue{system, connectionAttribute.String(p.connection)}
+	if name := databaseName(db.Dialector); name != "" {
+		attrs = append(attrs, semconv.DBName(name))
+	}
+	return attrs
+}
+
+// databaseName returns the name of the database a Postgres dialector
+// connects to, read from its DSN, or "" when it is not known
+func databaseName(dialector gorm.Dialector) string {
+	pg, ok := dialector.(*postgres.Dialector)
+	if !ok || pg.Config == nil || pg.DSN == "" {
+		return ""
+	}
+	cfg, err := pgconn.ParseConfig(pg.DSN)
+	if err != nil {
+		return ""
+	}
+	return cfg.Database
+}
+
+// before starts the operation span. operation is "" for raw and row
+// statements, whose operation is read from the SQL once it is known.
+func (p *TracingPlugin) before(db *gorm.DB, operation string) func(*gorm.DB) {
+	attrs := p.baseAttributes(db)
+	return func(tx *gorm.DB) {
+		name := operation
+		if name == "" {
+			name = "SQL"
+		}
+		if tx.Statement.Table != "" {
+			name += " " + tx.Statement.Table
+		}
+
+		ctx, span := p.tracer.Start(tx.Statement.Context, name,
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(attrs...),
+		)
+		tx.Statement.Context = ctx
+		tx.InstanceSet(tracingSpanKey, span)
+	}
+}
+
+// after records the statement and outcome on the span and ends it
+func (p *TracingPlugin) after(tx *gorm.DB) {
+	v, ok := tx.InstanceGet(tracingSpanKey)
+	if !ok {
+		return
+	}
+	span, ok := v.(trace.Span)
+	if !ok {
+		return
+	}
+	defer span.End()
+
+	sql := tx.Statement.SQL.String()
+	operation := firstKeyword(sql)
+	name := operation
+	if tx.Statement.Table != "" {
+		name = strings.TrimSpace(name + " " + tx.Statement.Table)
+		span.SetAttributes(semconv.DBSQLTable(tx.Statement.Table))
+	}
+	if name != "" {
+		span.SetName(name)
+	}
+	if operation != "" {
+		span.SetAttributes(semconv.DBOperation(operation))
+	}
+	if p.statement && sql != "" {
+		span.SetAttributes(semconv.DBStatement(normalizeSQL(sql)))
+	}
+	span.SetAttributes(attribute.Int64("db.rows_affected", tx.RowsAffected))
+
+	if tx.Error != nil && !errors.Is(tx.Error, gorm.ErrRecordNotFound) {
+		span.RecordError(tx.Error)
+		span.SetStatus(codes.Error, tx.Error.Error())
+	}
+}
@@ -3,42 +3,217 @@ package dbx
 import (
 	"context"
 	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/gostratum/core/logx"
 	"gorm.io/gorm"
 )
 
+
+// TxOptions holds per-transaction settings applied with SET LOCAL.
+// Zero values leave the server setting untouched.
+type TxOptions struct {
+	StatementTimeout       time.Duration
+	LockTimeout            time.Duration
+	IdleInTxSessionTimeout time.Duration
+}
+
+// TxOption configures a transaction
+type TxOption func(*TxOptions)
+
+// WithStatementTimeout sets statement_timeout for the transaction
+func WithStatementTimeout(d time.Duration) TxOption {
+	return func(o *TxOptions) {
+		o.StatementTimeout = d
+	}
+}
+
+// WithLockTimeout sets lock_timeout for the transaction
+func WithLockTimeout(d time.Duration) TxOption {
+	return func(o *TxOptions) {
+		o.LockTimeout = d
+	}
+}
+
+// WithIdleInTxSessionTimeout sets idle_in_transaction_session_timeout for the transaction
+func WithIdleInTxSessionTimeout(d time.Duration) TxOption {
+	return func(o *TxOptions) {
+		o.IdleInTxSessionTimeout = d
+	}
+}
+
+// statements returns the SET LOCAL statements for the configured settings
+func (o TxOptions) statements() []string {
+	settings := []struct {
+		name  string
+		value time.Duration
+	}{
+		{"statement_timeout", o.StatementTimeout},
+		{"lock_timeout", o.LockTimeout},
+		{"idle_in_transaction_session_timeout", o.IdleInTxSessionTimeout},
+	}
+
+	var stmts []string
+	for _, s := range settings {
+		if s.value <= 0 {
+			continue
+		}
+		// Postgres takes milliseconds; never round a positive timeout down to 0 (disabled)
+		ms := s.value.Milliseconds()
+		if ms == 0 {
+			ms = 1
+		}
+		stmts = append(stmts, fmt.Sprintf("SET LOCAL %s = %d", s.name, ms))
+	}
+	return stmts
+}
+
+// txState carries per-database transaction defaults in the connection
+// registry so that every transaction started through dbx can find them. It
+// also tracks open transactions for metrics and the long-transaction watchdog.
+type txState struct {
+	name            string
+	defaults        TxOptions
+	longTxThreshold time.Duration
+	leakDetection   bool
+	autoRollback    bool
+	logger          logx.Logger
+	metrics         atomic.Pointer[txMetrics]
+	tracing         atomic.Pointer[txTracing]
+
+	mu     sync.Mutex
+	open   map[gorm.ConnPool]*txRecord
+	nextID uint64
+	stop   chan struct{}
+}
+
+// newTxState creates the transaction state of a database
+func newTxState(name string, dbCfg *DatabaseConfig, logger logx.Logger) *txState {
+	return &txState{
+		name:            name,
+		defaults:        dbCfg.TxOptions(),
+		longTxThreshold: dbCfg.LongTxThreshold,
+		leakDetection:   dbCfg.TxLeakDetection,
+		autoRollback:    dbCfg.TxAutoRollback,
+		logger:          logger.With(logx.String("component", "tx"), logx.String("database", name)),
+		open:            make(map[gorm.ConnPool]*txRecord),
+	}
+}
+
+// txStateFor returns the transaction state registered for db, if any
+func txStateFor(db *gorm.DB) *txState {
+	if s := connectionStateFor(db); s != nil {
+		return s.tx
+	}
+	return nil
+}
+
+// resolveTxOptions merges database defaults with the given option layers,
+// later layers taking precedence
+func resolveTxOptions(db *gorm.DB, layers ...[]TxOption) TxOptions {
+	var opts TxOptions
+	if p := txStateFor(db); p != nil {
+		opts = p.defaults
+	}
+	for _, layer := range layers {
+		for _, opt := range layer {
+			opt(&opts)
+		}
+	}
+	return opts
+}
+
+// applyTxOptions applies the settings to an open transaction
+func applyTxOptions(tx *gorm.DB, opts TxOptions) error {
+	if tx.Dialector.Name() != "postgres" {
+		return nil
+	}
+	for _, stmt := range opts.statements() {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return fmt.Errorf("failed to apply transaction setting (%s): %w", stmt, err)
+		}
+	}
+	return nil
+}
+
+// isInTransaction reports whether db is already bound to a transaction
+func isInTransaction(db *gorm.DB) bool {
+	_, ok := db.Statement.ConnPool.(gorm.TxCommitter)
+	return ok
+}
+
+// runTx runs fn in a transaction with the resolved settings applied.
+// Nested calls reuse the outer transaction's settings.
+func runTx(db *gorm.DB, fn func(tx *gorm.DB) error, layers ...[]TxOption) error {
+	if isInTransaction(db) {
+		return db.Transaction(fn)
+	}
+
+	p := txStateFor(db)
+	opts := resolveTxOptions(db, layers...)
+
+	// The record is finished when GORM commits or rolls back
+	return db.Transaction(func(tx *gorm.DB) error {
+		p.track(tx, false)
+		if err := applyTxOptions(tx, opts); err != nil {
+			return err
+		}
+		return fn(tx)
+	})
+}
+
+// beginTx starts a transaction with the resolved settings applied
+func beginTx(db *gorm.DB, layers ...[]TxOption) *gorm.DB {
+	tx := db.Begin()
+	if tx.Error != nil {
+		return tx
+	}
+
+	txStateFor(db).track(tx, true)
+
+	if err := applyTxOptions(tx, resolveTxOptions(db, layers...)); err != nil {
+		tx.Rollback()
+		tx.AddError(err)
+	}
+	return tx
+}
+
 // WithTx executes a function within a database transaction
 // If the function returns an error, the transaction is rolled back
 // Otherwise, the transaction is committed
-func WithTx(db *gorm.DB, fn func(tx *gorm.DB) error) error {
-	return db.Transaction(fn)
+func WithTx(db *gorm.DB, fn func(tx *gorm.DB) error, opts ...TxOption) error {
+	return runTx(db, fn, opts)
 }
 
 // WithTxContext executes a function within a database transaction with context
-func WithTxContext(ctx context.Context, db *gorm.DB, fn func(ctx context.Context, tx *gorm.DB) error) error {
-	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+func WithTxContext(ctx context.Context, db *gorm.DB, fn func(ctx context.Context, tx *gorm.DB) error, opts ...TxOption) error {
+	return runTx(db.WithContext(ctx), func(tx *gorm.DB) error {
 		return fn(ctx, tx)
-	})
+	}, opts)
 }
 
 // TxManager provides transaction management utilities
 type TxManager struct {
-	db *gorm.DB
+	db   *gorm.DB
+	opts []TxOption
 }
 
-// NewTxManager creates a new transaction manager
-func NewTxManager(db *gorm.DB) *TxManager {
-	return &TxManager{db: db}
+// NewTxManager creates a new transaction manager. The options apply to every
+// transaction it starts, on top of the database defaults.
+func NewTxManager(db *gorm.DB, opts ...TxOption) *TxManager {
+	return &TxManager{db: db, opts: opts}
 }
 
 // Begin starts a new transaction
-func (tm *TxManager) Begin() *gorm.DB {
-	return tm.db.Begin()
+func (tm *TxManager) Begin(opts ...TxOption) *gorm.DB {
+	return beginTx(tm.db, tm.opts, opts)
 }
 
 // BeginContext starts a new transaction with context
-func (tm *TxManager) BeginContext(ctx context.Context) *gorm.DB {
-	return tm.db.WithContext(ctx).Begin()
+func (tm *TxManager) BeginContext(ctx context.Context, opts ...TxOption) *gorm.DB {
+	return beginTx(tm.db.WithContext(ctx), tm.opts, opts)
 }
 
 // Commit commits the transaction
@@ -58,13 +233,15 @@ func (tm *TxManager) Rollback(tx *gorm.DB) error {
 }
 
 // WithTx executes a function within a transaction managed by TxManager
-func (tm *TxManager) WithTx(fn func(tx *gorm.DB) error) error {
-	return WithTx(tm.db, fn)
+func (tm *TxManager) WithTx(fn func(tx *gorm.DB) error, opts ...TxOption) error {
+	return runTx(tm.db, fn, tm.opts, opts)
 }
 
 // WithTxContext executes a function within a transaction with context
-func (tm *TxManager) WithTxContext(ctx context.Context, fn func(ctx context.Context, tx *gorm.DB) error) error {
-	return WithTxContext(ctx, tm.db, fn)
+func (tm *TxManager) WithTxContext(ctx context.Context, fn func(ctx context.Context, tx *gorm.DB) error, opts ...TxOption) error {
+	return runTx(tm.db.WithContext(ctx), func(tx *gorm.DB) error {
+		return fn(ctx, tx)
+	}, tm.opts, opts)
 }
 
 // SavePoint creates a savepoint within the current transaction
@@ -90,21 +267,21 @@ type TxWrapper struct {
 }
 
 // NewTxWrapper creates a new transaction wrapper
-func NewTxWrapper(db *gorm.DB) *TxWrapper {
+func NewTxWrapper(db *gorm.DB, opts ...TxOption) *TxWrapper {
 	return &TxWrapper{
 		DB:      db,
-		manager: NewTxManager(db),
+		manager: NewTxManager(db, opts...),
 	}
 }
 
 // WithTx executes a function within a transaction
-func (tw *TxWrapper) WithTx(fn func(tx *gorm.DB) error) error {
-	return tw.manager.WithTx(fn)
+func (tw *TxWrapper) WithTx(fn func(tx *gorm.DB) error, opts ...TxOption) error {
+	return tw.manager.WithTx(fn, opts...)
 }
 
 // WithTxContext executes a function within a transaction with context
-func (tw *TxWrapper) WithTxContext(ctx context.Context, fn func(ctx context.Context, tx *gorm.DB) error) error {
-	return tw.manager.WithTxContext(ctx, fn)
+func (tw *TxWrapper) WithTxContext(ctx context.Context, fn func(ctx context.Context, tx *gorm.DB) error, opts ...TxOption) error {
+	return tw.manager.WithTxContext(ctx, fn, opts...)
 }
 
 // Manager returns the underlying transaction manager
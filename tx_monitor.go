@@ -0,0 +1,555 @@
+package dbx
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gostratum/core/logx"
+	"github.com/gostratum/metricsx"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"gorm.io/gorm"
+)
+
+// ErrTxAbandoned is returned by a transaction that tx_auto_rollback rolled
+// back because its context was done
+var ErrTxAbandoned = errors.New("transaction rolled back by dbx because its context is done")
+
+const (
+	minWatchdogInterval = 100 * time.Millisecond
+	maxWatchdogInterval = 10 * time.Second
+)
+
+// txRecord tracks a transaction started through dbx until it finishes
+type txRecord struct {
+	id      uint64
+	conn    gorm.ConnPool
+	tracked *trackedTx
+	ctx     context.Context
+	manual  bool
+	started time.Time
+	caller  string
+	stack   string
+	warned  bool
+	span    trace.Span
+}
+
+// OpenTransaction describes a transaction that has begun but not finished
+type OpenTransaction struct {
+	ID       uint64
+	Database string
+	Started  time.Time
+	Age      time.Duration
+	// Manual is true for transactions begun with TxManager.Begin
+	Manual bool
+	Caller string
+	// Stack is only recorded when tx_leak_detection is enabled
+	Stack string
+}
+
+// OpenTransactions returns the transactions currently open on db, oldest
+// first. Transactions are only tracked while tx_leak_detection,
+// tx_auto_rollback, long_tx_threshold, metrics or tracing is enabled.
+func OpenTransactions(db *gorm.DB) []OpenTransaction {
+	return txStateFor(db).openTransactions()
+}
+
+// openTransactions snapshots the tracked transactions
+func (p *txState) openTransactions() []OpenTransaction {
+	if p == nil {
+		return nil
+	}
+
+	now := time.Now()
+	p.mu.Lock()
+	out := make([]OpenTransaction, 0, len(p.open))
+	for _, rec := range p.open {
+		out = append(out, OpenTransaction{
+			ID:       rec.id,
+			Database: p.name,
+			Started:  rec.started,
+			Age:      now.Sub(rec.started),
+			Manual:   rec.manual,
+			Caller:   rec.caller,
+			Stack:    rec.stack,
+		})
+	}
+	p.mu.Unlock()
+
+	sort.Slice(out, func(i, j int) bool { return out[i].ID < out[j].ID })
+	return out
+}
+
+// OpenTransactions returns the open transactions of every connection
+func (c Connections) OpenTransactions() map[string][]OpenTransaction {
+	out := make(map[string][]OpenTransaction, len(c))
+	for name, db := range c {
+		out[name] = OpenTransactions(db)
+	}
+	return out
+}
+
+// txMetrics holds the transaction metric collectors
+type txMetrics struct {
+	begins    metricsx.Counter
+	commits   metricsx.Counter
+	rollbacks metricsx.Counter
+	duration  metricsx.Histogram
+	open      metricsx.Gauge
+}
+
+// newTxMetrics creates the transaction metric collectors
+func newTxMetrics(metrics metricsx.Metrics, durationBuckets []float64) *txMetrics {
+	return &txMetrics{
+		begins: metrics.Counter(
+			"db_transaction_begins_total",
+			metricsx.WithHelp("Total number of transactions started through dbx"),
+			metricsx.WithLabels("database"),
+		),
+		commits: metrics.Counter(
+			"db_transaction_commits_total",
+			metricsx.WithHelp("Total number of committed transactions"),
+			metricsx.WithLabels("database"),
+		),
+		rollbacks: metrics.Counter(
+			"db_transaction_rollbacks_total",
+			metricsx.WithHelp("Total number of rolled back transactions"),
+			metricsx.WithLabels("database"),
+		),
+		duration: metrics.Histogram(
+			"db_transaction_duration_seconds",
+			metricsx.WithHelp("Transaction duration in seconds"),
+			metricsx.WithLabels("database", "outcome"),
+			metricsx.WithBuckets(durationBuckets...),
+		),
+		open: metrics.Gauge(
+			"db_transactions_open",
+			metricsx.WithHelp("Current number of open transactions"),
+			metricsx.WithLabels("database"),
+		),
+	}
+}
+
+// setMetrics enables transaction metrics for the database. Of the metrics
+// options only WithTransactionDurationBuckets applies.
+func (p *txState) setMetrics(metrics metricsx.Metrics, opts ...MetricsOption) {
+	if p == nil || metrics == nil {
+		return
+	}
+	p.metrics.Store(newTxMetrics(metrics, newMetricsPlugin(opts...).txDurationBuckets))
+}
+
+// txTracing holds the tracer used for transaction spans
+type txTracing struct {
+	tracer trace.Tracer
+	attrs  []attribute.KeyValue
+}
+
+// setTracer enables a span per transaction for the database
+func (p *txState) setTracer(tracer trace.Tracer, attrs []attribute.KeyValue) {
+	if p == nil || tracer == nil {
+		return
+	}
+	p.tracing.Store(&txTracing{tracer: tracer, attrs: attrs})
+}
+
+// tracking reports whether a feature that needs open transactions is enabled
+func (p *txState) tracking() bool {
+	return p.leakDetection || p.autoRollback || p.longTxThreshold > 0 ||
+		p.metrics.Load() != nil || p.tracing.Load() != nil
+}
+
+// track records a newly begun transaction when tracking is enabled. The
+// caller is only resolved for tracked transactions.
+func (p *txState) track(tx *gorm.DB, manual bool) {
+	if p == nil || !p.tracking() {
+		return
+	}
+
+	rec := &txRecord{
+		ctx:     tx.Statement.Context,
+		manual:  manual,
+		started: time.Now(),
+		caller:  callerLocation(),
+	}
+	if manual && p.leakDetection {
+		rec.stack = string(debug.Stack())
+	}
+
+	// Statements run in the transaction become children of its span
+	if t := p.tracing.Load(); t != nil {
+		ctx, span := t.tracer.Start(rec.ctx, "transaction",
+			trace.WithSpanKind(trace.SpanKindClient),
+			trace.WithAttributes(t.attrs...),
+		)
+		tx.Statement.Context = ctx
+		rec.span = span
+	}
+
+	p.watchCompletion(tx, rec)
+
+	p.mu.Lock()
+	p.nextID++
+	rec.id = p.nextID
+	p.open[rec.conn] = rec
+	p.mu.Unlock()
+
+	if m := p.metrics.Load(); m != nil {
+		m.begins.Inc(p.name)
+		m.open.Inc(p.name)
+	}
+}
+
+// watchCompletion wraps the transaction's connection so that the record is
+// finished however the transaction ends, including a direct tx.Commit()
+func (p *txState) watchCompletion(tx *gorm.DB, rec *txRecord) {
+	done := func(committed bool) { p.finish(rec, committed) }
+
+	switch pool := tx.Statement.ConnPool.(type) {
+	case *gorm.PreparedStmtTX:
+		// GORM type-asserts *PreparedStmtTX for savepoints, so wrap inside it
+		rec.tracked = &trackedTx{Tx: pool.Tx, done: done}
+		pool.Tx = rec.tracked
+	case gorm.Tx:
+		rec.tracked = &trackedTx{Tx: pool, done: done}
+		tx.Statement.ConnPool = rec.tracked
+	}
+	rec.conn = tx.Statement.ConnPool
+}
+
+// trackedTx reports the outcome of a transaction when it commits or rolls back
+type trackedTx struct {
+	gorm.Tx
+	done func(committed bool)
+
+	mu sync.Mutex
+	// err is set once the watchdog has rolled the transaction back
+	err error
+}
+
+// Commit commits the transaction and finishes its record
+func (t *trackedTx) Commit() error {
+	t.mu.Lock()
+	if t.err != nil {
+		t.mu.Unlock()
+		return t.err
+	}
+	err := t.Tx.Commit()
+	done := t.done
+	t.mu.Unlock()
+
+	done(err == nil)
+	return err
+}
+
+// Rollback rolls back the transaction and finishes its record
+func (t *trackedTx) Rollback() error {
+	t.mu.Lock()
+	if t.err != nil {
+		t.mu.Unlock()
+		return t.err
+	}
+	err := t.Tx.Rollback()
+	done := t.done
+	t.mu.Unlock()
+
+	done(false)
+	return err
+}
+
+// ExecContext runs a statement unless the transaction was abandoned
+func (t *trackedTx) ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if err := t.abandoned(); err != nil {
+		return nil, err
+	}
+	return t.Tx.ExecContext(ctx, query, args...)
+}
+
+// QueryContext runs a query unless the transaction was abandoned
+func (t *trackedTx) QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error) {
+	if err := t.abandoned(); err != nil {
+		return nil, err
+	}
+	return t.Tx.QueryContext(ctx, query, args...)
+}
+
+// detachOutcome stops the record of tx from being finished when its
+// connection commits or rolls back, and returns the function that finishes it
+// instead. Two-phase commit reports the outcome of COMMIT/ROLLBACK PREPARED
+// rather than the release of the connection after PREPARE TRANSACTION.
+func detachOutcome(tx *gorm.DB) func(committed bool) {
+	pool := tx.Statement.ConnPool
+	if prepared, ok := pool.(*gorm.PreparedStmtTX); ok {
+		pool = prepared.Tx
+	}
+	t, ok := pool.(*trackedTx)
+	if !ok {
+		return func(bool) {}
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	done := t.done
+	t.done = func(bool) {}
+	return done
+}
+
+// abandoned returns the error recorded when the watchdog rolled back
+func (t *trackedTx) abandoned() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.err
+}
+
+// abandon rolls the transaction back on behalf of its owner, whose later
+// calls through the wrapper fail with ErrTxAbandoned. It does not finish the
+// record; the caller does.
+func (t *trackedTx) abandon(cause error) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.err != nil {
+		return nil
+	}
+	t.err = fmt.Errorf("%w: %v", ErrTxAbandoned, cause)
+	return t.Tx.Rollback()
+}
+
+// GetDBConn returns the pool the transaction was begun on, for gorm.DB.DB
+func (t *trackedTx) GetDBConn() (*sql.DB, error) {
+	return (&gorm.DB{Config: &gorm.Config{ConnPool: t.Tx}}).DB()
+}
+
+// finish records the outcome of a tracked transaction
+func (p *txState) finish(rec *txRecord, committed bool) {
+	if p == nil || rec == nil {
+		return
+	}
+
+	p.mu.Lock()
+	if p.open[rec.conn] != rec {
+		// Already finished
+		p.mu.Unlock()
+		return
+	}
+	delete(p.open, rec.conn)
+	p.mu.Unlock()
+
+	p.recordOutcome(rec, committed)
+}
+
+// recordOutcome ends the span and updates metrics for a finished transaction
+func (p *txState) recordOutcome(rec *txRecord, committed bool) {
+	if rec.span != nil {
+		rec.span.SetAttributes(attribute.Bool("db.transaction.committed", committed))
+		rec.span.End()
+	}
+
+	if m := p.metrics.Load(); m != nil {
+		outcome := "rollback"
+		if committed {
+			outcome = "commit"
+			m.commits.Inc(p.name)
+		} else {
+			m.rollbacks.Inc(p.name)
+		}
+		m.open.Dec(p.name)
+		m.duration.Observe(time.Since(rec.started).Seconds(), p.name, outcome)
+	}
+
+	if rec.warned {
+		p.logger.Info("Long-running transaction finished",
+			logx.Duration("duration", time.Since(rec.started)),
+			logx.String("began_at", rec.caller),
+			logx.Bool("committed", committed),
+		)
+	}
+}
+
+// reportLeaks logs manually begun transactions that were never finished
+// when leak detection is enabled
+func (p *txState) reportLeaks() int {
+	if p == nil || !p.leakDetection {
+		return 0
+	}
+
+	leaks := 0
+	for _, open := range p.openTransactions() {
+		if !open.Manual {
+			continue
+		}
+		leaks++
+		fields := []logx.Field{
+			logx.Duration("open_for", open.Age),
+			logx.String("began_at", open.Caller),
+		}
+		if open.Stack != "" {
+			fields = append(fields, logx.String("stack", open.Stack))
+		}
+		p.logger.Error("Leaked transaction: begun but never committed or rolled back", fields...)
+	}
+	return leaks
+}
+
+// rollbackAbandoned rolls back manual transactions whose context is done.
+// The rollback goes through the tracked connection, never the caller's
+// *gorm.DB, which its owner may still be using.
+func (p *txState) rollbackAbandoned() {
+	type rolledBack struct {
+		rec *txRecord
+		err error
+	}
+	var abandoned []rolledBack
+
+	p.mu.Lock()
+	for conn, rec := range p.open {
+		if !rec.manual || rec.tracked == nil || rec.ctx == nil || rec.ctx.Err() == nil {
+			continue
+		}
+		err := rec.tracked.abandon(context.Cause(rec.ctx))
+		delete(p.open, conn)
+		abandoned = append(abandoned, rolledBack{rec: rec, err: err})
+	}
+	p.mu.Unlock()
+
+	for _, a := range abandoned {
+		p.recordOutcome(a.rec, false)
+
+		fields := []logx.Field{
+			logx.Duration("open_for", time.Since(a.rec.started)),
+			logx.String("began_at", a.rec.caller),
+			logx.String("reason", context.Cause(a.rec.ctx).Error()),
+		}
+		// database/sql may already have rolled back on cancellation
+		if a.err != nil && !errors.Is(a.err, sql.ErrTxDone) {
+			p.logger.Error("Failed to roll back abandoned transaction", append(fields, logx.Err(a.err))...)
+			continue
+		}
+		p.logger.Warn("Rolled back abandoned transaction whose context is done", fields...)
+	}
+}
+
+// startWatchdog starts the watchdog if long-transaction detection or
+// auto-rollback is configured
+func (p *txState) startWatchdog() {
+	if p == nil || (p.longTxThreshold <= 0 && !p.autoRollback) {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stop != nil {
+		return
+	}
+	p.stop = make(chan struct{})
+
+	interval := maxWatchdogInterval
+	if p.longTxThreshold > 0 {
+		interval = watchdogInterval(p.longTxThreshold)
+	}
+	if p.autoRollback {
+		interval = min(interval, time.Second)
+	}
+	go p.watch(p.stop, interval)
+}
+
+// stopWatchdog stops the watchdog goroutine
+func (p *txState) stopWatchdog() {
+	if p == nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.stop != nil {
+		close(p.stop)
+		p.stop = nil
+	}
+}
+
+// watch periodically checks open transactions
+func (p *txState) watch(stop <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if p.autoRollback {
+				p.rollbackAbandoned()
+			}
+			p.checkLongTransactions(time.Now())
+		case <-stop:
+			return
+		}
+	}
+}
+
+// checkLongTransactions warns once about each transaction over the threshold
+func (p *txState) checkLongTransactions(now time.Time) {
+	if p.longTxThreshold <= 0 {
+		return
+	}
+
+	var long []txRecord
+
+	p.mu.Lock()
+	for _, rec := range p.open {
+		if !rec.warned && now.Sub(rec.started) > p.longTxThreshold {
+			rec.warned = true
+			long = append(long, *rec)
+		}
+	}
+	p.mu.Unlock()
+
+	for _, rec := range long {
+		p.logger.Warn("Long-running transaction detected",
+			logx.Duration("open_for", now.Sub(rec.started)),
+			logx.Duration("threshold", p.longTxThreshold),
+			logx.String("began_at", rec.caller),
+		)
+	}
+}
+
+// watchdogInterval derives the polling interval from the threshold
+func watchdogInterval(threshold time.Duration) time.Duration {
+	interval := threshold / 4
+	if interval < minWatchdogInterval {
+		interval = minWatchdogInterval
+	}
+	if interval > maxWatchdogInterval {
+		interval = maxWatchdogInterval
+	}
+	return interval
+}
+
+// callerLocation returns file:line of the first caller outside dbx and GORM
+func callerLocation() string {
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs)
+	frames := runtime.CallersFrames(pcs[:n])
+
+	for {
+		frame, more := frames.Next()
+		if !isInternalFrame(frame) {
+			return fmt.Sprintf("%s:%d", frame.File, frame.Line)
+		}
+		if !more {
+			return "unknown"
+		}
+	}
+}
+
+// isInternalFrame reports whether a stack frame belongs to dbx or GORM
+func isInternalFrame(frame runtime.Frame) bool {
+	return strings.HasPrefix(frame.Function, "gorm.io/") ||
+		strings.HasPrefix(frame.Function, "github.com/gostratum/dbx.") ||
+		strings.HasPrefix(frame.Function, "github.com/gostratum/dbx/migrate")
+}
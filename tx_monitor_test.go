@@ -0,0 +1,399 @@
+package dbx
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gostratum/core/logx"
+	"github.com/gostratum/metricsx"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/gorm"
+)
+
+// logEntry is a single captured log line
+type logEntry struct {
+	level  string
+	msg    string
+	fields map[string]any
+}
+
+// recordingLogger captures log lines for assertions
+type recordingLogger struct {
+	mu      *sync.Mutex
+	entries *[]logEntry
+	fields  []logx.Field
+}
+
+func newRecordingLogger() *recordingLogger {
+	return &recordingLogger{mu: &sync.Mutex{}, entries: &[]logEntry{}}
+}
+
+func (l *recordingLogger) record(level, msg string, fields []logx.Field) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	values := make(map[string]any)
+	for _, f := range append(append([]logx.Field{}, l.fields...), fields...) {
+		switch {
+		case f.String != "":
+			values[f.Key] = f.String
+		case f.Interface != nil:
+			values[f.Key] = f.Interface
+		default:
+			values[f.Key] = f.Integer
+		}
+	}
+	*l.entries = append(*l.entries, logEntry{level: level, msg: msg, fields: values})
+}
+
+func (l *recordingLogger) Debug(msg string, fields ...logx.Field) { l.record("debug", msg, fields) }
+func (l *recordingLogger) Info(msg string, fields ...logx.Field)  { l.record("info", msg, fields) }
+func (l *recordingLogger) Warn(msg string, fields ...logx.Field)  { l.record("warn", msg, fields) }
+func (l *recordingLogger) Error(msg string, fields ...logx.Field) { l.record("error", msg, fields) }
+func (l *recordingLogger) With(fields ...logx.Field) logx.Logger {
+	return &recordingLogger{mu: l.mu, entries: l.entries, fields: append(append([]logx.Field{}, l.fields...), fields...)}
+}
+
+// find returns captured entries with the given message
+func (l *recordingLogger) find(msg string) []logEntry {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var out []logEntry
+	for _, e := range *l.entries {
+		if e.msg == msg {
+			out = append(out, e)
+		}
+	}
+	return out
+}
+
+// mockMetrics is an in-memory metricsx.Metrics for tests
+type mockMetrics struct {
+	mu         sync.Mutex
+	counters   map[string]float64
+	gauges     map[string]float64
+	histograms map[string][]float64
+	options    map[string]*metricsx.Options
+}
+
+func newMockMetrics() *mockMetrics {
+	return &mockMetrics{
+		counters:   make(map[string]float64),
+		gauges:     make(map[string]float64),
+		histograms: make(map[string][]float64),
+		options:    make(map[string]*metricsx.Options),
+	}
+}
+
+func (m *mockMetrics) register(name string, opts []metricsx.Option) {
+	o := &metricsx.Options{}
+	for _, opt := range opts {
+		opt(o)
+	}
+	m.mu.Lock()
+	m.options[name] = o
+	m.mu.Unlock()
+}
+
+func (m *mockMetrics) Counter(name string, opts ...metricsx.Option) metricsx.Counter {
+	m.register(name, opts)
+	return &mockCollector{m: m, name: name}
+}
+
+func (m *mockMetrics) Gauge(name string, opts ...metricsx.Option) metricsx.Gauge {
+	m.register(name, opts)
+	return &mockCollector{m: m, name: name}
+}
+
+func (m *mockMetrics) Histogram(name string, opts ...metricsx.Option) metricsx.Histogram {
+	m.register(name, opts)
+	return &mockCollector{m: m, name: name}
+}
+
+func (m *mockMetrics) Summary(name string, opts ...metricsx.Option) metricsx.Summary {
+	m.register(name, opts)
+	return &mockCollector{m: m, name: name}
+}
+
+func (m *mockMetrics) counter(name string, labels ...string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.counters[metricKey(name, labels)]
+}
+
+func (m *mockMetrics) gauge(name string, labels ...string) float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.gauges[metricKey(name, labels)]
+}
+
+func (m *mockMetrics) observations(name string, labels ...string) []float64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.histograms[metricKey(name, labels)]
+}
+
+func metricKey(name string, labels []string) string {
+	return name + "{" + strings.Join(labels, ",") + "}"
+}
+
+// mockCollector implements every metricsx collector interface
+type mockCollector struct {
+	m    *mockMetrics
+	name string
+}
+
+func (c *mockCollector) Inc(labels ...string) { c.Add(1, labels...) }
+func (c *mockCollector) Dec(labels ...string) { c.Add(-1, labels...) }
+func (c *mockCollector) Sub(value float64, labels ...string) {
+	c.Add(-value, labels...)
+}
+
+func (c *mockCollector) Add(value float64, labels ...string) {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	key := metricKey(c.name, labels)
+	if _, isGauge := c.m.gauges[key]; isGauge || strings.Contains(c.name, "open") || strings.Contains(c.name, "in_flight") {
+		c.m.gauges[key] += value
+		return
+	}
+	c.m.counters[key] += value
+}
+
+func (c *mockCollector) Set(value float64, labels ...string) {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	c.m.gauges[metricKey(c.name, labels)] = value
+}
+
+func (c *mockCollector) Observe(value float64, labels ...string) {
+	c.m.mu.Lock()
+	defer c.m.mu.Unlock()
+	key := metricKey(c.name, labels)
+	c.m.histograms[key] = append(c.m.histograms[key], value)
+}
+
+func (c *mockCollector) Timer(labels ...string) metricsx.Timer { return nil }
+
+func setupMonitoredDB(t *testing.T, dbCfg *DatabaseConfig, logger logx.Logger) (*gorm.DB, *txState) {
+	db := setupTestDB(t)
+	state := newTxState("primary", dbCfg, logger)
+	registerState(t, "primary", db, &connectionState{tx: state})
+	require.NoError(t, db.Exec("CREATE TABLE test_users (id INTEGER PRIMARY KEY, name TEXT)").Error)
+	return db, state
+}
+
+func TestTxMetrics(t *testing.T) {
+	db, state := setupMonitoredDB(t, &DatabaseConfig{}, &testLogger{})
+	metrics := newMockMetrics()
+	state.setMetrics(metrics)
+
+	require.NoError(t, WithTx(db, func(tx *gorm.DB) error {
+		assert.Equal(t, 1.0, metrics.gauge("db_transactions_open", "primary"))
+		return tx.Exec("INSERT INTO test_users (name) VALUES (?)", "Dan").Error
+	}))
+
+	_ = WithTx(db, func(tx *gorm.DB) error { return errors.New("boom") })
+
+	manager := NewTxManager(db)
+	tx := manager.Begin()
+	require.NoError(t, tx.Error)
+	require.NoError(t, manager.Commit(tx))
+
+	assert.Equal(t, 3.0, metrics.counter("db_transaction_begins_total", "primary"))
+	assert.Equal(t, 2.0, metrics.counter("db_transaction_commits_total", "primary"))
+	assert.Equal(t, 1.0, metrics.counter("db_transaction_rollbacks_total", "primary"))
+	assert.Equal(t, 0.0, metrics.gauge("db_transactions_open", "primary"))
+	assert.Len(t, metrics.observations("db_transaction_duration_seconds", "primary", "commit"), 2)
+	assert.Len(t, metrics.observations("db_transaction_duration_seconds", "primary", "rollback"), 1)
+}
+
+func TestDetachOutcome(t *testing.T) {
+	db, state := setupMonitoredDB(t, &DatabaseConfig{}, &testLogger{})
+	metrics := newMockMetrics()
+	state.setMetrics(metrics)
+
+	tx := NewTxManager(db).Begin()
+	require.NoError(t, tx.Error)
+	done := detachOutcome(tx)
+
+	// Releasing the connection leaves the record open
+	require.NoError(t, tx.Commit().Error)
+	assert.Zero(t, metrics.counter("db_transaction_commits_total", "primary"))
+	assert.Equal(t, 1.0, metrics.gauge("db_transactions_open", "primary"))
+
+	done(false)
+	assert.Zero(t, metrics.counter("db_transaction_commits_total", "primary"))
+	assert.Equal(t, 1.0, metrics.counter("db_transaction_rollbacks_total", "primary"))
+	assert.Equal(t, 0.0, metrics.gauge("db_transactions_open", "primary"))
+
+	// Untracked transactions get a no-op
+	untracked := setupTestDB(t).Begin()
+	detachOutcome(untracked)(true)
+	require.NoError(t, untracked.Commit().Error)
+}
+
+func TestTxMetrics_DirectCommitAndRollback(t *testing.T) {
+	for _, prepareStmt := range []bool{false, true} {
+		db, state := setupMonitoredDB(t, &DatabaseConfig{}, &testLogger{})
+		db = db.Session(&gorm.Session{PrepareStmt: prepareStmt})
+		metrics := newMockMetrics()
+		state.setMetrics(metrics, WithTransactionDurationBuckets(0.1, 1))
+
+		manager := NewTxManager(db)
+		committed := manager.Begin()
+		require.NoError(t, committed.Error)
+		_, prepared := committed.Statement.ConnPool.(*gorm.PreparedStmtTX)
+		assert.Equal(t, prepareStmt, prepared)
+		require.NoError(t, committed.Exec("INSERT INTO test_users (name) VALUES (?)", "Eve").Error)
+		sqlDB, err := committed.DB()
+		require.NoError(t, err)
+		require.NotNil(t, sqlDB)
+		require.NoError(t, committed.Commit().Error)
+
+		rolledBack := manager.Begin()
+		require.NoError(t, rolledBack.SavePoint("sp").Error)
+		require.NoError(t, rolledBack.RollbackTo("sp").Error)
+		require.NoError(t, rolledBack.Rollback().Error)
+
+		// Finishing twice is counted once
+		require.Error(t, manager.Commit(committed))
+
+		assert.Empty(t, OpenTransactions(db))
+		assert.Equal(t, 1.0, metrics.counter("db_transaction_commits_total", "primary"))
+		assert.Equal(t, 1.0, metrics.counter("db_transaction_rollbacks_total", "primary"))
+		assert.Equal(t, 0.0, metrics.gauge("db_transactions_open", "primary"))
+		assert.Equal(t, []float64{0.1, 1}, metrics.options["db_transaction_duration_seconds"].Buckets)
+	}
+}
+
+func TestLongTransactionWatchdog(t *testing.T) {
+	logger := newRecordingLogger()
+	db, state := setupMonitoredDB(t, &DatabaseConfig{LongTxThreshold: 10 * time.Millisecond}, logger)
+
+	manager := NewTxManager(db)
+	tx := manager.Begin()
+	require.NoError(t, tx.Error)
+
+	state.checkLongTransactions(time.Now().Add(time.Second))
+	state.checkLongTransactions(time.Now().Add(2 * time.Second))
+
+	warnings := logger.find("Long-running transaction detected")
+	require.Len(t, warnings, 1, "each transaction is reported once")
+	assert.NotEmpty(t, warnings[0].fields["began_at"])
+	assert.Equal(t, "primary", warnings[0].fields["database"])
+
+	require.NoError(t, manager.Rollback(tx))
+	assert.Len(t, logger.find("Long-running transaction finished"), 1)
+}
+
+func TestWatchdogInterval(t *testing.T) {
+	assert.Equal(t, minWatchdogInterval, watchdogInterval(time.Millisecond))
+	assert.Equal(t, time.Second, watchdogInterval(4*time.Second))
+	assert.Equal(t, maxWatchdogInterval, watchdogInterval(time.Hour))
+}
+
+func TestTxLeakDetection(t *testing.T) {
+	logger := newRecordingLogger()
+	db, state := setupMonitoredDB(t, &DatabaseConfig{TxLeakDetection: true}, logger)
+
+	require.NoError(t, WithTx(db, func(tx *gorm.DB) error {
+		open := OpenTransactions(db)
+		require.Len(t, open, 1)
+		assert.False(t, open[0].Manual)
+		assert.Empty(t, open[0].Stack, "stacks are only recorded for manual transactions")
+		return nil
+	}))
+
+	manager := NewTxManager(db)
+	finished := manager.Begin()
+	require.NoError(t, manager.Commit(finished))
+
+	leaked := manager.Begin()
+	require.NoError(t, leaked.Error)
+	defer leaked.Rollback()
+
+	open := Connections{"primary": db}.OpenTransactions()["primary"]
+	require.Len(t, open, 1)
+	assert.True(t, open[0].Manual)
+	assert.Equal(t, "primary", open[0].Database)
+	assert.NotEmpty(t, open[0].Caller)
+	assert.Contains(t, open[0].Stack, "TestTxLeakDetection")
+
+	assert.Equal(t, 1, state.reportLeaks())
+	errs := logger.find("Leaked transaction: begun but never committed or rolled back")
+	require.Len(t, errs, 1)
+	assert.Contains(t, errs[0].fields["stack"], "TestTxLeakDetection")
+}
+
+func TestTxTracking_Disabled(t *testing.T) {
+	logger := newRecordingLogger()
+	db, state := setupMonitoredDB(t, &DatabaseConfig{}, logger)
+
+	tx := NewTxManager(db).Begin()
+	require.NoError(t, tx.Error)
+	defer tx.Rollback()
+
+	assert.Empty(t, OpenTransactions(db), "nothing is tracked without a feature needing it")
+	assert.Equal(t, 0, state.reportLeaks())
+	assert.Empty(t, logger.find("Leaked transaction: begun but never committed or rolled back"))
+}
+
+func TestTxAutoRollback(t *testing.T) {
+	logger := newRecordingLogger()
+	db, state := setupMonitoredDB(t, &DatabaseConfig{TxAutoRollback: true}, logger)
+	manager := NewTxManager(db)
+
+	live := manager.Begin()
+	require.NoError(t, live.Error)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	abandoned := manager.BeginContext(ctx)
+	require.NoError(t, abandoned.Error)
+	cancel()
+
+	state.rollbackAbandoned()
+
+	open := OpenTransactions(db)
+	require.Len(t, open, 1, "only the transaction with a live context stays open")
+	assert.Len(t, logger.find("Rolled back abandoned transaction whose context is done"), 1)
+
+	// The owner learns why its transaction is gone
+	assert.ErrorIs(t, abandoned.Exec("SELECT 1").Error, ErrTxAbandoned)
+	err := abandoned.Commit().Error
+	assert.ErrorIs(t, err, ErrTxAbandoned)
+	assert.ErrorContains(t, err, context.Canceled.Error())
+	assert.Len(t, OpenTransactions(db), 1)
+
+	require.NoError(t, manager.Rollback(live))
+	assert.Empty(t, OpenTransactions(db))
+}
+
+func TestTxAutoRollback_ConcurrentUse(t *testing.T) {
+	db, state := setupMonitoredDB(t, &DatabaseConfig{TxAutoRollback: true}, newRecordingLogger())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	tx := NewTxManager(db).BeginContext(ctx)
+	require.NoError(t, tx.Error)
+
+	// The owner keeps using its transaction while the watchdog rolls it back
+	done := make(chan error)
+	go func() {
+		for {
+			if err := tx.Exec("SELECT 1").Error; err != nil {
+				done <- err
+				return
+			}
+		}
+	}()
+	cancel()
+	state.rollbackAbandoned()
+
+	err := <-done
+	assert.True(t, errors.Is(err, ErrTxAbandoned) || errors.Is(err, context.Canceled), err)
+	assert.Empty(t, OpenTransactions(db))
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"gorm.io/driver/sqlite"
@@ -125,3 +126,43 @@ func TestTxWrapper(t *testing.T) {
 	// Test that manager is accessible
 	assert.NotNil(t, wrapper.Manager())
 }
+
+func TestTxOptionsStatements(t *testing.T) {
+	assert.Empty(t, TxOptions{}.statements())
+
+	opts := TxOptions{
+		StatementTimeout:       5 * time.Second,
+		LockTimeout:            500 * time.Microsecond,
+		IdleInTxSessionTimeout: time.Minute,
+	}
+	assert.Equal(t, []string{
+		"SET LOCAL statement_timeout = 5000",
+		"SET LOCAL lock_timeout = 1",
+		"SET LOCAL idle_in_transaction_session_timeout = 60000",
+	}, opts.statements())
+}
+
+func TestResolveTxOptions(t *testing.T) {
+	db := setupTestDB(t)
+	registerState(t, "primary", db, &connectionState{tx: newTxState("primary", &DatabaseConfig{StatementTimeout: time.Second, LockTimeout: time.Second}, &testLogger{})})
+
+	manager := NewTxManager(db, WithStatementTimeout(2*time.Second))
+
+	opts := resolveTxOptions(db, manager.opts, []TxOption{WithLockTimeout(3 * time.Second)})
+	assert.Equal(t, 2*time.Second, opts.StatementTimeout)
+	assert.Equal(t, 3*time.Second, opts.LockTimeout)
+	assert.Zero(t, opts.IdleInTxSessionTimeout)
+
+	// Settings are only applied on postgres; other dialects still run the transaction
+	err := db.Exec("CREATE TABLE test_users (id INTEGER PRIMARY KEY, name TEXT)").Error
+	assert.NoError(t, err)
+
+	err = manager.WithTx(func(tx *gorm.DB) error {
+		return tx.Exec("INSERT INTO test_users (name) VALUES (?)", "Carol").Error
+	}, WithIdleInTxSessionTimeout(time.Minute))
+	assert.NoError(t, err)
+
+	tx := manager.Begin(WithStatementTimeout(time.Second))
+	assert.NoError(t, tx.Error)
+	assert.NoError(t, manager.Rollback(tx))
+}